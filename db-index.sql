@@ -1,5 +1,7 @@
 CREATE DATABASE index;
 
+CREATE EXTENSION IF NOT EXISTS fuzzystrmatch;
+
 CREATE TABLE words(
     w_id serial PRIMARY KEY,
     word text
@@ -7,12 +9,27 @@ CREATE TABLE words(
 
 CREATE TABLE files(
     f_id serial PRIMARY KEY,
-    name_file text
+    name_file text,
+    length integer,
+    size bigint,
+    mod_time bigint,
+    hash text
 );
 
 CREATE TABLE positions(
     w_id integer REFERENCES words(w_id),
     f_id integer REFERENCES files(f_id),
-    position integer
+    position integer,
+    byte_offset integer,
+    length integer,
+    line integer,
+    form text
+);
+
+CREATE TABLE meta(
+    key text PRIMARY KEY,
+    value text
 );
 
+CREATE INDEX words_word_idx ON words(word text_pattern_ops);
+CREATE INDEX positions_form_idx ON positions(form text_pattern_ops);
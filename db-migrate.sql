@@ -0,0 +1,23 @@
+-- Updates database created by older db-index.sql to the current schema.
+-- Files indexed before the update have no spans, lengths and surface forms of words,
+-- index the folder to db again to fill them.
+
+CREATE EXTENSION IF NOT EXISTS fuzzystrmatch;
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS length integer;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS size bigint;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS mod_time bigint;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS hash text;
+
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS byte_offset integer;
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS length integer;
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS line integer;
+ALTER TABLE positions ADD COLUMN IF NOT EXISTS form text;
+
+CREATE TABLE IF NOT EXISTS meta(
+    key text PRIMARY KEY,
+    value text
+);
+
+CREATE INDEX IF NOT EXISTS words_word_idx ON words(word text_pattern_ops);
+CREATE INDEX IF NOT EXISTS positions_form_idx ON positions(form text_pattern_ops);
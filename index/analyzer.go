@@ -0,0 +1,291 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/kljensen/snowball/english"
+	"github.com/zoomio/stopwords"
+)
+
+// DefaultAnalyzer is name of analyzer used if other isn't set
+const DefaultAnalyzer = "english"
+
+// ErrWordTooLong is returned by tokenizers and analyzers after reading of text with words longer
+// than maxWordLength. Such words are skipped, other words of text are emitted
+var ErrWordTooLong = errors.New("Words longer than 1 MB are skipped")
+
+// Tokenizer reads words of text one by one and passes them to emit with their places in text
+type Tokenizer interface {
+	Tokenize(r io.Reader, emit func(word string, span Span)) error
+}
+
+// Span is place of word in text: byte offset, length in bytes and number of line starting from 1
+type Span struct {
+	Offset int
+	Length int
+	Line   int
+}
+
+// TokenFilter changes token, false is returned if token must be dropped
+type TokenFilter interface {
+	Filter(token string) (string, bool)
+}
+
+// FilterFunc is func which can be used as TokenFilter
+type FilterFunc func(token string) (string, bool)
+
+// Filter calls f(token)
+func (f FilterFunc) Filter(token string) (string, bool) {
+	return f(token)
+}
+
+// Token is word of text after filters, Position is number of the word in text before filters
+// and Span is place of the word in text. Form is the word as it's written in text, only trimmed
+// and lower cased, it's shown to users instead of the stem
+type Token struct {
+	Text     string
+	Position int
+	Span     Span
+	Form     string
+}
+
+// Keyword is word of search phrase with its tokens in every language of analyzer,
+// Position is number of the word in search phrase before filters
+type Keyword struct {
+	Variants []string
+	Position int
+}
+
+// Analyzer converts text to tokens. The same analyzer must be used for indexing and searching,
+// so its name is saved with index. AnalyzeQuery returns variants of tokens for every word of query
+type Analyzer interface {
+	Name() string
+	Analyze(r io.Reader) ([]Token, error)
+	AnalyzeQuery(text string) ([]Keyword, error)
+}
+
+// chain is analyzer built from tokenizer and filters, filters are applied in order
+type chain struct {
+	name      string
+	tokenizer Tokenizer
+	filters   []TokenFilter
+}
+
+// NewAnalyzer returns analyzer passing words of tokenizer through the chain of filters
+func NewAnalyzer(name string, tokenizer Tokenizer, filters ...TokenFilter) Analyzer {
+	return &chain{
+		name:      name,
+		tokenizer: tokenizer,
+		filters:   filters,
+	}
+}
+
+func (c *chain) Name() string {
+	return c.name
+}
+
+// Analyze returns tokens of text, positions of dropped words are skipped.
+// Tokens are returned with ErrWordTooLong too
+func (c *chain) Analyze(r io.Reader) ([]Token, error) {
+	var tokens []Token
+	position := 0
+	err := c.tokenizer.Tokenize(r, func(word string, span Span) {
+		if token, ok := c.filter(word); ok {
+			tokens = append(tokens, Token{Text: token, Position: position, Span: span, Form: surfaceForm(word)})
+		}
+		position++
+	})
+	if err != nil && err != ErrWordTooLong {
+		return nil, err
+	}
+	return tokens, err
+}
+
+func (c *chain) AnalyzeQuery(text string) ([]Keyword, error) {
+	tokens, err := c.Analyze(strings.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+	keywords := make([]Keyword, len(tokens))
+	for i, token := range tokens {
+		keywords[i] = Keyword{Variants: []string{token.Text}, Position: token.Position}
+	}
+	return keywords, nil
+}
+
+func (c *chain) filter(token string) (string, bool) {
+	for _, filter := range c.filters {
+		var ok bool
+		if token, ok = filter.Filter(token); !ok {
+			return "", false
+		}
+	}
+	return token, true
+}
+
+// WhitespaceTokenizer splits text by white spaces
+type WhitespaceTokenizer struct{}
+
+// Tokenize reads text by words without loading the whole text in memory
+func (WhitespaceTokenizer) Tokenize(r io.Reader, emit func(word string, span Span)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxWordLength)
+	var span Span
+	offset, line := 0, 1
+	skipping, skipped := false, false
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if skipping {
+			// the rest of too long word is dropped up to white space
+			advance := bytes.IndexFunc(data, unicode.IsSpace)
+			if advance < 0 {
+				advance = len(data)
+			} else {
+				skipping = false
+			}
+			offset += advance
+			return advance, nil, nil
+		}
+		advance, token, err := bufio.ScanWords(data, atEOF)
+		if advance == 0 && token == nil && err == nil && len(data) >= maxWordLength {
+			// buffer is full of one word, so the word is dropped
+			skipping, skipped = true, true
+			advance = len(data)
+		}
+		if token != nil {
+			// token is a part of data, so its start is found by capacity
+			start := cap(data) - cap(token)
+			span = Span{
+				Offset: offset + start,
+				Length: len(token),
+				Line:   line + bytes.Count(data[:start], []byte{'\n'}),
+			}
+		}
+		offset += advance
+		line += bytes.Count(data[:advance], []byte{'\n'})
+		return advance, token, err
+	})
+	for scanner.Scan() {
+		emit(scanner.Text(), span)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if skipped {
+		return ErrWordTooLong
+	}
+	return nil
+}
+
+// TrimFilter trims not letters and not numbers at the edges of token, empty tokens are dropped
+var TrimFilter = FilterFunc(func(token string) (string, bool) {
+	token = strings.TrimFunc(token, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return token, token != ""
+})
+
+// surface returns Form of token, tokens of analyzers not setting Form have Text as form
+func (token Token) surface() string {
+	if token.Form == "" {
+		return token.Text
+	}
+	return token.Form
+}
+
+// surfaceForm returns word of text without not letters and not numbers at the edges in lower case
+func surfaceForm(word string) string {
+	word, _ = TrimFilter(word)
+	return strings.ToLower(word)
+}
+
+// LowerCaseFilter converts token to lower case
+var LowerCaseFilter = FilterFunc(func(token string) (string, bool) {
+	return strings.ToLower(token), true
+})
+
+// EnglishStemFilter replaces token by its stem
+var EnglishStemFilter = FilterFunc(func(token string) (string, bool) {
+	return english.Stem(token, false), true
+})
+
+// StopWordsFilter drops english stop words
+var StopWordsFilter = FilterFunc(func(token string) (string, bool) {
+	return token, !stopwords.IsStopWord(token) && token != ""
+})
+
+// ApostropheFilter removes the first apostrophe in token
+var ApostropheFilter = FilterFunc(func(token string) (string, bool) {
+	return strings.Replace(token, "'", "", 1), true
+})
+
+var (
+	analyzersMu sync.RWMutex
+	analyzers   = map[string]Analyzer{}
+)
+
+// englishAnalyzer is DefaultAnalyzer, it's also used by HandleWords
+var englishAnalyzer = &chain{
+	name:      English,
+	tokenizer: DefaultTokenizer,
+	filters:   []TokenFilter{TrimFilter, LowerCaseFilter, EnglishStemFilter, StopWordsFilter, ApostropheFilter},
+}
+
+func init() {
+	RegisterAnalyzer(englishAnalyzer)
+	RegisterAnalyzer(NewAnalyzer("simple", DefaultTokenizer, TrimFilter, LowerCaseFilter))
+	RegisterAnalyzer(NewAnalyzer(Russian, DefaultTokenizer,
+		TrimFilter, LowerCaseFilter, RussianStopWordsFilter, RussianStemFilter))
+	RegisterAnalyzer(NewMultilingualAnalyzer("multilingual", DefaultTokenizer))
+}
+
+// RegisterAnalyzer makes analyzer available by its name
+func RegisterAnalyzer(analyzer Analyzer) {
+	analyzersMu.Lock()
+	defer analyzersMu.Unlock()
+	analyzers[analyzer.Name()] = analyzer
+}
+
+// AnalyzerByName returns registered analyzer, empty name means DefaultAnalyzer
+func AnalyzerByName(name string) (Analyzer, error) {
+	if name == "" {
+		name = DefaultAnalyzer
+	}
+	analyzersMu.RLock()
+	defer analyzersMu.RUnlock()
+	analyzer, ok := analyzers[name]
+	if !ok {
+		return nil, fmt.Errorf("Analyzer %q isn't found, known analyzers: %v", name, analyzerNames())
+	}
+	return analyzer, nil
+}
+
+func analyzerNames() []string {
+	names := make([]string, 0, len(analyzers))
+	for name := range analyzers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckAnalyzer returns error if index is built by other analyzer than name
+func CheckAnalyzer(indexAnalyzer, name string) error {
+	if indexAnalyzer == "" {
+		indexAnalyzer = DefaultAnalyzer
+	}
+	if name == "" {
+		name = DefaultAnalyzer
+	}
+	if indexAnalyzer != name {
+		return fmt.Errorf("Index is built with analyzer %q, but analyzer %q is used", indexAnalyzer, name)
+	}
+	return nil
+}
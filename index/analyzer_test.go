@@ -0,0 +1,87 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzers(t *testing.T) {
+	text := "The Handling of -Black- tea, I+ "
+	cases := map[string][]string{
+		"english": []string{"handl", "black", "tea"},
+		"simple":  []string{"the", "handling", "of", "black", "tea", "i"},
+	}
+	for name, expect := range cases {
+		analyzer, err := AnalyzerByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens, err := analyzer.Analyze(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := tokenTexts(tokens)
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%v: %v isn't equal to expected %v", name, actual, expect)
+		}
+	}
+
+	if _, err := AnalyzerByName("klingon"); err == nil {
+		t.Error("unknown analyzer is found")
+	}
+}
+
+func TestAnalyzerPositions(t *testing.T) {
+	tokens, err := englishAnalyzer.Analyze(strings.NewReader("The state of the art"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Token{{"state", 1, Span{4, 5, 1}, "state"}, {"art", 4, Span{17, 3, 1}, "art"}}
+	if !reflect.DeepEqual(tokens, expect) {
+		t.Errorf("%v isn't equal to expected %v", tokens, expect)
+	}
+}
+
+func tokenTexts(tokens []Token) []string {
+	texts := make([]string, len(tokens))
+	for i, token := range tokens {
+		texts[i] = token.Text
+	}
+	return texts
+}
+
+func TestCheckAnalyzer(t *testing.T) {
+	if err := CheckAnalyzer("", DefaultAnalyzer); err != nil {
+		t.Errorf("index without analyzer name isn't matched with default analyzer: %v", err)
+	}
+	if err := CheckAnalyzer("simple", "english"); err == nil {
+		t.Error("different analyzers are matched")
+	}
+}
+
+func TestIndexAnalyzerMismatch(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt": "Cups of tea",
+	})
+	defer os.RemoveAll(root)
+
+	simple, err := AnalyzerByName("simple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{Analyzer: simple}); err != nil {
+		t.Fatal(err)
+	}
+	if idx.Analyzer != "simple" {
+		t.Errorf("analyzer %q isn't saved in index", idx.Analyzer)
+	}
+	if actual, _ := idx.Searching("CUPS"); !reflect.DeepEqual(actual, []string{"1.txt"}) {
+		t.Errorf("search with index analyzer returns %v", actual)
+	}
+	if _, err := idx.Update(Options{}); err == nil {
+		t.Error("index is updated with other analyzer")
+	}
+}
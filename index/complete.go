@@ -0,0 +1,138 @@
+package index
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/polisgo2020/search-tarival/model"
+)
+
+// Completion is indexed word starting with typed prefix, Freq is count of files with the word
+type Completion struct {
+	Word string
+	Freq int
+}
+
+// Complete returns up to count words starting with prefix, words found in more files are the first.
+// Surface forms of words are completed, indexes without them complete indexed words. Count < 1 means no words
+func (idx *Index) Complete(prefix string, count int) ([]Completion, error) {
+	if count < 1 {
+		return nil, nil
+	}
+	prefix = strings.ToLower(prefix)
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if forms := idx.surfaceForms(); len(forms) != 0 {
+		return forms.complete(prefix, count), nil
+	}
+	dict := idx.dictionary()
+	var completions []Completion
+	for i := sort.SearchStrings(dict, prefix); i < len(dict) && strings.HasPrefix(dict[i], prefix); i++ {
+		completions = append(completions, Completion{Word: dict[i], Freq: len(idx.Words[dict[i]])})
+	}
+	return topCompletions(completions, count), nil
+}
+
+// Complete returns up to count words of segment starting with prefix, words found in more files are the first.
+// Surface forms of words are completed, segments without them complete indexed words. Count < 1 means no words
+func (s *Segment) Complete(prefix string, count int) ([]Completion, error) {
+	if count < 1 {
+		return nil, nil
+	}
+	prefix = strings.ToLower(prefix)
+	if forms := s.surfaceForms(); len(forms) != 0 {
+		return forms.complete(prefix, count), nil
+	}
+	words, err := s.Expand(prefix+"*", 0)
+	if err != nil {
+		return nil, err
+	}
+	completions := make([]Completion, 0, len(words))
+	for _, word := range words {
+		i, err := s.seg.find(word)
+		if err != nil {
+			return nil, err
+		}
+		_, offset, length, err := s.seg.term(i)
+		if err != nil {
+			return nil, err
+		}
+		freq, err := s.seg.docFreq(offset, length)
+		if err != nil {
+			return nil, err
+		}
+		completions = append(completions, Completion{Word: word, Freq: freq})
+	}
+	return topCompletions(completions, count), nil
+}
+
+// CompleteDB returns up to count words in db starting with prefix, words found in more files are the first.
+// Surface forms of words are completed, indexes without them complete indexed words. Count < 1 means no words
+func CompleteDB(db *pg.DB, prefix string, count int) ([]Completion, error) {
+	if count < 1 {
+		return nil, nil
+	}
+	pattern := likePattern(strings.ToLower(prefix)) + "%"
+	ok, err := model.HasForms(db)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		forms, err := convertForms(model.SelectFormFreqs(db, pattern, count))
+		if err != nil {
+			return nil, err
+		}
+		return Forms(forms).completions(), nil
+	}
+	words, err := model.SelectWordFreqs(db, pattern, count)
+	if err != nil {
+		return nil, err
+	}
+	completions := make([]Completion, len(words))
+	for i, word := range words {
+		completions[i] = Completion{Word: word.Word, Freq: word.Freq}
+	}
+	return completions, nil
+}
+
+// complete returns up to count surface forms starting with prefix, forms found in more files are the first
+func (forms Forms) complete(prefix string, count int) []Completion {
+	start := sort.Search(len(forms), func(i int) bool { return forms[i].Form >= prefix })
+	end := start
+	for end < len(forms) && strings.HasPrefix(forms[end].Form, prefix) {
+		end++
+	}
+	return topCompletions(forms[start:end].completions(), count)
+}
+
+// completions converts forms to completions, form of several words has the largest count of files
+func (forms Forms) completions() []Completion {
+	var completions []Completion
+	index := map[string]int{}
+	for _, form := range forms {
+		if i, ok := index[form.Form]; ok {
+			if form.Freq > completions[i].Freq {
+				completions[i].Freq = form.Freq
+			}
+			continue
+		}
+		index[form.Form] = len(completions)
+		completions = append(completions, Completion{Word: form.Form, Freq: form.Freq})
+	}
+	return completions
+}
+
+// topCompletions returns up to count completions sorted by count of files and then by word
+func topCompletions(completions []Completion, count int) []Completion {
+	sort.Slice(completions, func(i, j int) bool {
+		if completions[i].Freq != completions[j].Freq {
+			return completions[i].Freq > completions[j].Freq
+		}
+		return completions[i].Word < completions[j].Word
+	})
+	if len(completions) > count {
+		completions = completions[:count]
+	}
+	return completions
+}
@@ -0,0 +1,50 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt": "black tea",
+		"2.txt": "Tea cup",
+		"3.txt": "team of teachers",
+		"4.txt": "configuration",
+	})
+	defer os.RemoveAll(root)
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	segment := openSegment(t, idx)
+
+	completes := map[string]func(prefix string, count int) ([]Completion, error){
+		"index":   idx.Complete,
+		"segment": segment.Complete,
+	}
+	cases := map[string][]Completion{
+		"Te":    []Completion{{"tea", 2}, {"teachers", 1}},
+		"confi": []Completion{{"configuration", 1}},
+	}
+	for name, complete := range completes {
+		for prefix, expect := range cases {
+			actual, err := complete(prefix, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, expect) {
+				t.Errorf("%v %q: %v isn't equal to expected %v", name, prefix, actual, expect)
+			}
+		}
+		for _, count := range []int{0, -1} {
+			if actual, err := complete("te", count); err != nil || len(actual) != 0 {
+				t.Errorf("%v %v: %v, %v isn't empty", name, count, actual, err)
+			}
+		}
+		if actual, _ := complete("milk", 2); len(actual) != 0 {
+			t.Errorf("%v: %v isn't empty", name, actual)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package index
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/polisgo2020/search-tarival/model"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultMaxExpansions is max count of words matching wildcard or fuzzy term of query
+const DefaultMaxExpansions = 50
+
+// source is storage of reverse index for searching. lookup returns files and positions of word,
+// expand returns up to limit words matching wildcard pattern in sorted order,
+// fuzzy returns up to limit the closest words within edit distance from word. Limit 0 means no limit.
+// expandForms and fuzzyForms are the same for surface forms of words, they are nil
+// if storage has no surface forms
+type source struct {
+	lookup      func(word string) ([]WordIndex, error)
+	expand      func(pattern string, limit int) ([]string, error)
+	fuzzy       func(word string, distance, limit int) ([]string, error)
+	expandForms func(pattern string, limit int) ([]Form, error)
+	fuzzyForms  func(word string, distance, limit int) ([]Form, error)
+}
+
+// Dictionary is sorted words of reverse index, it's used for expansion of wildcard terms
+type Dictionary []string
+
+// NewDictionary returns sorted words of index
+func NewDictionary(index ReverseIndex) Dictionary {
+	dict := make(Dictionary, 0, len(index))
+	for word := range index {
+		dict = append(dict, word)
+	}
+	sort.Strings(dict)
+	return dict
+}
+
+// Expand returns up to limit words matching pattern in sorted order, limit 0 means no limit.
+// Star in pattern matches any characters and question mark matches one character
+func (dict Dictionary) Expand(pattern string, limit int) ([]string, error) {
+	prefix := wildcardPrefix(pattern)
+	var words []string
+	for i := sort.SearchStrings(dict, prefix); i < len(dict) && strings.HasPrefix(dict[i], prefix); i++ {
+		if limit > 0 && len(words) == limit {
+			break
+		}
+		if matchWildcard(pattern, dict[i]) {
+			words = append(words, dict[i])
+		}
+	}
+	return words, nil
+}
+
+// Form is surface form of indexed Word, Freq is count of files with the word
+type Form struct {
+	Form string
+	Word string
+	Freq int
+}
+
+// Forms is surface forms of indexed words sorted by form and then by word. It's used for expansion
+// of wildcard terms, suggestions and completions, so users see words as they are written in files
+type Forms []Form
+
+// NewForms returns surface forms of words of index, forms is indexed words by their surface forms.
+// Freq of form is count of files with its word, forms of words missing in index are skipped
+func NewForms(index ReverseIndex, forms map[string]string) Forms {
+	sorted := make(Forms, 0, len(forms))
+	for form, word := range forms {
+		if freq := len(index[word]); freq != 0 {
+			sorted = append(sorted, Form{Form: form, Word: word, Freq: freq})
+		}
+	}
+	sortForms(sorted)
+	return sorted
+}
+
+// sortForms sorts forms by form and then by word
+func sortForms(forms Forms) {
+	sort.Slice(forms, func(i, j int) bool {
+		if forms[i].Form != forms[j].Form {
+			return forms[i].Form < forms[j].Form
+		}
+		return forms[i].Word < forms[j].Word
+	})
+}
+
+// Expand returns up to limit forms matching pattern in sorted order, limit 0 means no limit
+func (forms Forms) Expand(pattern string, limit int) ([]Form, error) {
+	prefix := wildcardPrefix(pattern)
+	var matches []Form
+	start := sort.Search(len(forms), func(i int) bool { return forms[i].Form >= prefix })
+	for i := start; i < len(forms) && strings.HasPrefix(forms[i].Form, prefix); i++ {
+		if limit > 0 && len(matches) == limit {
+			break
+		}
+		if matchWildcard(pattern, forms[i].Form) {
+			matches = append(matches, forms[i])
+		}
+	}
+	return matches, nil
+}
+
+// Fuzzy returns up to limit the closest forms within edit distance from word sorted by distance,
+// limit 0 means no limit. Only forms starting with the first rune of word are compared, see fuzzyPrefix
+func (forms Forms) Fuzzy(word string, distance, limit int) ([]Form, error) {
+	type formMatch struct {
+		form     Form
+		distance int
+	}
+	prefix := fuzzyPrefix(word)
+	target := []rune(word)
+	var matches []formMatch
+	start := sort.Search(len(forms), func(i int) bool { return forms[i].Form >= prefix })
+	for i := start; i < len(forms) && strings.HasPrefix(forms[i].Form, prefix); i++ {
+		if !fuzzyLength(len(target), forms[i].Form, distance) {
+			continue
+		}
+		if d, ok := editDistance(target, []rune(forms[i].Form), distance); ok {
+			matches = append(matches, formMatch{forms[i], d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].distance < matches[j].distance })
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	var closest []Form
+	for _, match := range matches {
+		closest = append(closest, match.form)
+	}
+	return closest, nil
+}
+
+// source returns storage of index with dictionary, it must be called with locked idx.mu.
+// Indexes written before surface forms were added have no forms
+func (idx *Index) source() source {
+	dict := idx.dictionary()
+	src := source{lookup: idx.Words.lookup, expand: dict.Expand, fuzzy: dict.Fuzzy}
+	if forms := idx.surfaceForms(); len(forms) != 0 {
+		src.expandForms, src.fuzzyForms = forms.Expand, forms.Fuzzy
+	}
+	return src
+}
+
+// dictionary returns dictionary of index, it's built after every change of index.
+// It must be called with locked idx.mu
+func (idx *Index) dictionary() Dictionary {
+	idx.dictMu.Lock()
+	defer idx.dictMu.Unlock()
+	if idx.dict == nil {
+		idx.dict = NewDictionary(idx.Words)
+	}
+	return idx.dict
+}
+
+// reverseDict is dictionary of the last searched ReverseIndex with count of its words
+var reverseDict struct {
+	mu    sync.Mutex
+	index ReverseIndex
+	words int
+	dict  Dictionary
+}
+
+// dictionary returns dictionary of reverse index. It's cached for the last searched index
+// and built again for another index or if count of words of index is changed
+func (index ReverseIndex) dictionary() Dictionary {
+	reverseDict.mu.Lock()
+	defer reverseDict.mu.Unlock()
+	if reverseDict.dict == nil || reverseDict.words != len(index) ||
+		reflect.ValueOf(reverseDict.index).Pointer() != reflect.ValueOf(index).Pointer() {
+		reverseDict.index, reverseDict.words, reverseDict.dict = index, len(index), NewDictionary(index)
+	}
+	return reverseDict.dict
+}
+
+// surfaceForms returns surface forms of index, they are built after every change of index.
+// It must be called with locked idx.mu
+func (idx *Index) surfaceForms() Forms {
+	idx.dictMu.Lock()
+	defer idx.dictMu.Unlock()
+	if idx.sorted == nil {
+		idx.sorted = NewForms(idx.Words, idx.Forms)
+	}
+	return idx.sorted
+}
+
+// surfaceForms returns surface forms of segment, they are decoded on the first call.
+// Segment is searched without forms if they are corrupted
+func (s *Segment) surfaceForms() Forms {
+	s.formsOnce.Do(func() {
+		forms, err := s.seg.surfaceForms()
+		if err != nil {
+			log.Error().Err(err).Msg("Surface forms of segment are not read")
+			return
+		}
+		s.forms = forms
+	})
+	return s.forms
+}
+
+// Expand returns up to limit words of segment matching pattern in sorted order, limit 0 means no limit
+func (s *Segment) Expand(pattern string, limit int) ([]string, error) {
+	prefix := wildcardPrefix(pattern)
+	start, err := s.seg.lowerBound(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var words []string
+	for i := start; i < s.seg.terms; i++ {
+		if limit > 0 && len(words) == limit {
+			break
+		}
+		key, _, err := s.seg.termKey(i)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(string(key), prefix) {
+			break
+		}
+		if matchWildcard(pattern, string(key)) {
+			words = append(words, string(key))
+		}
+	}
+	return words, nil
+}
+
+// Fuzzy returns up to limit the closest words within edit distance from word, limit 0 means no limit.
+// Only words starting with the first rune of word are compared, see fuzzyPrefix
+func (dict Dictionary) Fuzzy(word string, distance, limit int) ([]string, error) {
+	prefix := fuzzyPrefix(word)
+	target := []rune(word)
+	var matches []fuzzyMatch
+	for i := sort.SearchStrings(dict, prefix); i < len(dict) && strings.HasPrefix(dict[i], prefix); i++ {
+		if !fuzzyLength(len(target), dict[i], distance) {
+			continue
+		}
+		if d, ok := editDistance(target, []rune(dict[i]), distance); ok {
+			matches = append(matches, fuzzyMatch{dict[i], d})
+		}
+	}
+	return closestWords(matches, limit), nil
+}
+
+// Fuzzy returns up to limit the closest words of segment within edit distance from word,
+// limit 0 means no limit. Only words starting with the first rune of word are compared, see fuzzyPrefix
+func (s *Segment) Fuzzy(word string, distance, limit int) ([]string, error) {
+	prefix := fuzzyPrefix(word)
+	start, err := s.seg.lowerBound(prefix)
+	if err != nil {
+		return nil, err
+	}
+	target := []rune(word)
+	var matches []fuzzyMatch
+	for i := start; i < s.seg.terms; i++ {
+		key, _, err := s.seg.termKey(i)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(string(key), prefix) {
+			break
+		}
+		if !fuzzyLength(len(target), string(key), distance) {
+			continue
+		}
+		if d, ok := editDistance(target, []rune(string(key)), distance); ok {
+			matches = append(matches, fuzzyMatch{string(key), d})
+		}
+	}
+	return closestWords(matches, limit), nil
+}
+
+// fuzzyDB returns func finding words within edit distance in db by levenshtein of fuzzystrmatch
+func fuzzyDB(db *pg.DB) func(word string, distance, limit int) ([]string, error) {
+	return func(word string, distance, limit int) ([]string, error) {
+		return model.SelectWordsFuzzy(db, word, distance, limit)
+	}
+}
+
+// expandFormsDB returns func finding surface forms matching pattern in db by LIKE
+func expandFormsDB(db *pg.DB) func(pattern string, limit int) ([]Form, error) {
+	return func(pattern string, limit int) ([]Form, error) {
+		return convertForms(model.SelectFormsLike(db, likePattern(pattern), limit))
+	}
+}
+
+// fuzzyFormsDB returns func finding surface forms within edit distance in db by levenshtein of fuzzystrmatch
+func fuzzyFormsDB(db *pg.DB) func(word string, distance, limit int) ([]Form, error) {
+	return func(word string, distance, limit int) ([]Form, error) {
+		return convertForms(model.SelectFormsFuzzy(db, word, distance, limit))
+	}
+}
+
+func convertForms(wordForms []model.WordForm, err error) ([]Form, error) {
+	if err != nil {
+		return nil, err
+	}
+	forms := make([]Form, len(wordForms))
+	for i, form := range wordForms {
+		forms[i] = Form{Form: form.Form, Word: form.Word, Freq: form.Freq}
+	}
+	return forms, nil
+}
+
+// sourceDB returns storage of index in db, files is names of files by id.
+// Indexes written before surface forms were added have no forms
+func sourceDB(db *pg.DB, files map[int]string) (source, error) {
+	src := source{lookup: lookupDB(db, files), expand: expandDB(db), fuzzy: fuzzyDB(db)}
+	ok, err := model.HasForms(db)
+	if err != nil {
+		return source{}, err
+	}
+	if ok {
+		src.expandForms, src.fuzzyForms = expandFormsDB(db), fuzzyFormsDB(db)
+	}
+	return src, nil
+}
+
+// fuzzyMatch is word found by edit distance
+type fuzzyMatch struct {
+	word     string
+	distance int
+}
+
+// closestWords returns up to limit words sorted by distance and then by word
+func closestWords(matches []fuzzyMatch, limit int) []string {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].word < matches[j].word
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	var words []string
+	for _, match := range matches {
+		words = append(words, match.word)
+	}
+	return words
+}
+
+// fuzzyPrefix returns the first rune of word. Typos are rare in the first letter, so only words
+// with the same first rune are compared by edit distance and they are found by binary search
+func fuzzyPrefix(word string) string {
+	_, size := utf8.DecodeRuneInString(word)
+	return word[:size]
+}
+
+// fuzzyLength reports if count of runes of candidate differs from length at most by distance,
+// it's checked before candidate is converted to runes for editDistance
+func fuzzyLength(length int, candidate string, distance int) bool {
+	n := utf8.RuneCountInString(candidate)
+	return n >= length-distance && n <= length+distance
+}
+
+// editDistance returns Levenshtein distance between a and b, false is returned if it's more than max
+func editDistance(a, b []rune, max int) (int, bool) {
+	if len(a)-len(b) > max || len(b)-len(a) > max {
+		return 0, false
+	}
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j-1]+cost, minInt(prev[j]+1, cur[j-1]+1))
+			rowMin = minInt(rowMin, cur[j])
+		}
+		if rowMin > max {
+			return 0, false
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)], prev[len(b)] <= max
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// expandDB returns func finding words matching pattern in db by LIKE
+func expandDB(db *pg.DB) func(pattern string, limit int) ([]string, error) {
+	return func(pattern string, limit int) ([]string, error) {
+		return model.SelectWordsLike(db, likePattern(pattern), limit)
+	}
+}
+
+// likePattern converts wildcard pattern to pattern of LIKE
+func likePattern(pattern string) string {
+	var b strings.Builder
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteByte('%')
+		case '?':
+			b.WriteByte('_')
+		case '%', '_', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// isWildcard reports if text of term is pattern with wildcards
+func isWildcard(text string) bool {
+	return strings.ContainsAny(text, "*?")
+}
+
+// wildcardPrefix returns part of pattern before the first wildcard
+func wildcardPrefix(pattern string) string {
+	if i := strings.IndexAny(pattern, "*?"); i >= 0 {
+		return pattern[:i]
+	}
+	return pattern
+}
+
+// matchWildcard reports if word matches pattern, star matches any characters and question mark
+// matches one character
+func matchWildcard(pattern, word string) bool {
+	// star and next are places to return to if the rest of word doesn't match pattern after the last star
+	star, next := -1, 0
+	p, w := 0, 0
+	for w < len(word) {
+		r, size := utf8.DecodeRuneInString(word[w:])
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				star, next = p, w
+				p++
+				continue
+			case '?':
+				p++
+				w += size
+				continue
+			default:
+				pr, psize := utf8.DecodeRuneInString(pattern[p:])
+				if pr == r {
+					p += psize
+					w += size
+					continue
+				}
+			}
+		}
+		if star == -1 {
+			return false
+		}
+		_, size = utf8.DecodeRuneInString(word[next:])
+		next += size
+		p, w = star+1, next
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,240 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMatchWildcard(t *testing.T) {
+	cases := []struct {
+		pattern, word string
+		expect        bool
+	}{
+		{"config*", "config", true},
+		{"config*", "configur", true},
+		{"config*", "conf", false},
+		{"wh?te", "white", true},
+		{"wh?te", "whte", false},
+		{"*ite", "white", true},
+		{"w*t*", "white", true},
+		{"w*i*e", "wxixe", true},
+		{"w*x", "white", false},
+		{"ч?й", "чай", true},
+		{"*", "", true},
+	}
+	for _, c := range cases {
+		if actual := matchWildcard(c.pattern, c.word); actual != c.expect {
+			t.Errorf("%q, %q: %v isn't equal to expected %v", c.pattern, c.word, actual, c.expect)
+		}
+	}
+}
+
+func TestDictionaryExpand(t *testing.T) {
+	index := ReverseIndex{}
+	for _, word := range []string{"config", "configur", "conf", "white", "whit", "write", "чай"} {
+		index[word] = []WordIndex{WordIndex{"1.txt", []int{0}, nil}}
+	}
+
+	segment := openSegment(t, &Index{Words: index})
+
+	expands := map[string]func(pattern string, limit int) ([]string, error){
+		"dictionary": NewDictionary(index).Expand,
+		"segment":    segment.Expand,
+	}
+	cases := []struct {
+		pattern string
+		limit   int
+		expect  []string
+	}{
+		{"config*", 0, []string{"config", "configur"}},
+		{"wh?te", 0, []string{"white"}},
+		{"w*te", 0, []string{"white", "write"}},
+		{"*", 2, []string{"conf", "config"}},
+		{"ч*", 0, []string{"чай"}},
+		{"milk*", 0, nil},
+	}
+	for name, expand := range expands {
+		for _, c := range cases {
+			actual, err := expand(c.pattern, c.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actual, c.expect) {
+				t.Errorf("%v %q: %v isn't equal to expected %v", name, c.pattern, actual, c.expect)
+			}
+		}
+	}
+}
+
+func TestReverseIndexDictionary(t *testing.T) {
+	index := ReverseIndex{"tea": nil, "cup": nil}
+	dict := index.dictionary()
+	if cached := index.dictionary(); &cached[0] != &dict[0] {
+		t.Error("dictionary isn't cached")
+	}
+
+	index["milk"] = nil
+	if actual, expect := index.dictionary(), (Dictionary{"cup", "milk", "tea"}); !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+	other := ReverseIndex{"coffee": nil, "cup": nil, "tea": nil}
+	if actual, expect := other.dictionary(), (Dictionary{"coffee", "cup", "tea"}); !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	if actual, expect := likePattern(`wh?te*_10%\`), `wh_te%\_10\%\\`; actual != expect {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+}
+
+func TestSearchingWildcard(t *testing.T) {
+	idx := NewIndex("")
+	idx.Analyzer = DefaultAnalyzer
+	idx.Words.addFileInIndex("1.txt", analyze(t, "configuration of server"))
+	idx.Words.addFileInIndex("2.txt", analyze(t, "configured white server"))
+	idx.Words.addFileInIndex("3.txt", analyze(t, "write config"))
+
+	cases := map[string][]string{
+		"config*":           []string{"1.txt", "2.txt", "3.txt"},
+		"wh?te":             []string{"2.txt"},
+		"Config* AND serv*": []string{"1.txt", "2.txt"},
+		"config* -wh*":      []string{"1.txt", "3.txt"},
+		"milk*":             []string{},
+	}
+	for text, expect := range cases {
+		actual, err := idx.Searching(text)
+		if err != nil {
+			t.Errorf("%q: %v", text, err)
+			continue
+		}
+		sort.Strings(actual)
+		if len(actual) == 0 {
+			actual = []string{}
+		}
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%q: %v isn't equal to expected %v", text, actual, expect)
+		}
+	}
+
+	_, err := idx.SearchingWith("w*", SearchOptions{MaxExpansions: 1})
+	expect := &QueryError{Pos: 0, Msg: "w* matches more than 1 words"}
+	if !reflect.DeepEqual(err, expect) {
+		t.Errorf("%v isn't equal to expected %v", err, expect)
+	}
+
+}
+
+func TestSearchingWildcardForms(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt": "Walking searching",
+		"2.txt": "walks",
+		"3.txt": "happy",
+	})
+	defer os.RemoveAll(root)
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	segment := openSegment(t, idx)
+
+	searchers := map[string]Searcher{
+		"index":   idx,
+		"segment": segment,
+	}
+	cases := map[string][]string{
+		"walki*":     []string{"1.txt", "2.txt"},
+		"searching*": []string{"1.txt"},
+		"search?ng":  []string{"1.txt"},
+		"walk*":      []string{"1.txt", "2.txt"},
+		"happy*":     []string{"3.txt"},
+		"talk*":      []string{},
+	}
+	for name, searcher := range searchers {
+		for text, expect := range cases {
+			results, err := searcher.Search(text, SearchOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual := results.Files()
+			sort.Strings(actual)
+			if !reflect.DeepEqual(actual, expect) {
+				t.Errorf("%v %q: %v isn't equal to expected %v", name, text, actual, expect)
+			}
+		}
+	}
+
+	_, err := idx.Search("walk*", SearchOptions{MaxExpansions: 1})
+	expect := &QueryError{Pos: 0, Msg: "walk* matches more than 1 words"}
+	if !reflect.DeepEqual(err, expect) {
+		t.Errorf("%v isn't equal to expected %v", err, expect)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b   string
+		max    int
+		expect int
+		ok     bool
+	}{
+		{"serach", "search", 2, 2, true},
+		{"serach", "search", 1, 0, false},
+		{"tea", "tea", 0, 0, true},
+		{"tea", "teas", 1, 1, true},
+		{"чай", "чаи", 1, 1, true},
+		{"cup", "coffee", 2, 0, false},
+	}
+	for _, c := range cases {
+		actual, ok := editDistance([]rune(c.a), []rune(c.b), c.max)
+		if actual != c.expect || ok != c.ok {
+			t.Errorf("%q, %q: %v, %v isn't equal to expected %v, %v", c.a, c.b, actual, ok, c.expect, c.ok)
+		}
+	}
+}
+
+func TestSearchingFuzzy(t *testing.T) {
+	index := ReverseIndex{}
+	index.addFileInIndex("1.txt", analyze(t, "full text search"))
+	index.addFileInIndex("2.txt", analyze(t, "search engine and research"))
+	index.addFileInIndex("3.txt", analyze(t, "test coffee"))
+
+	dict := NewDictionary(index)
+	if actual, _ := dict.Fuzzy("serach", 2, 0); !reflect.DeepEqual(actual, []string{"search"}) {
+		t.Errorf("%v isn't equal to expected %v", actual, []string{"search"})
+	}
+	src := source{lookup: index.lookup, expand: dict.Expand, fuzzy: dict.Fuzzy}
+
+	cases := []struct {
+		query     string
+		autoFuzzy int
+		ranked    bool
+		expect    []string
+	}{
+		{"serach", 0, false, nil},
+		{"serach~2", 0, false, []string{"1.txt", "2.txt"}},
+		{"serach~1", 0, false, nil},
+		{"serach", 2, false, []string{"1.txt", "2.txt"}},
+		{"serach", 1, false, nil},
+		{"test~1", 0, true, []string{"3.txt", "1.txt"}},
+		{"coffee text~1", 0, true, []string{"1.txt", "3.txt"}},
+	}
+	for _, c := range cases {
+		actual, err := searching(src, englishAnalyzer, c.query, SearchOptions{AutoFuzzy: c.autoFuzzy}, newCollection(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) == 0 {
+			actual = nil
+		}
+		if !c.ranked {
+			sort.Strings(actual)
+		}
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("%q: %v isn't equal to expected %v", c.query, actual, c.expect)
+		}
+	}
+}
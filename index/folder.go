@@ -0,0 +1,214 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxWordLength is the longest word which can be read from file, longer words are skipped
+const maxWordLength = 1024 * 1024
+
+var errStopped = errors.New("folder processing is stopped")
+
+// Options is params of folder indexing
+type Options struct {
+	// MaxDepth is max depth of indexed subfolders, < 1 means no limit
+	MaxDepth int
+	// Workers is count of goroutines reading and tokenizing files, < 1 means runtime.NumCPU()
+	Workers int
+	// Analyzer converts text of files to tokens, nil means DefaultAnalyzer
+	Analyzer Analyzer
+}
+
+func (opts Options) workers() int {
+	if opts.Workers < 1 {
+		return runtime.NumCPU()
+	}
+	return opts.Workers
+}
+
+func (opts Options) analyzer() Analyzer {
+	if opts.Analyzer == nil {
+		return englishAnalyzer
+	}
+	return opts.Analyzer
+}
+
+type fileData struct {
+	name   string
+	tokens []Token
+	doc    Document
+}
+
+type walkedFile struct {
+	name string
+	info os.FileInfo
+}
+
+// walkFiles walks the folder tree and calls handle for paths of files relative to the root.
+// Subfolders deeper than maxDepth are skipped, maxDepth < 1 means no limit
+func walkFiles(root string, maxDepth int, handle func(name string, info os.FileInfo) error) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if rel != "." && maxDepth > 0 && depth(rel) >= maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return handle(filepath.ToSlash(rel), info)
+	})
+}
+
+// listFiles returns paths of files in folder tree relative to the root
+func listFiles(root string, maxDepth int) ([]string, error) {
+	var files []string
+	err := walkFiles(root, maxDepth, func(name string, _ os.FileInfo) error {
+		files = append(files, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// depth returns count of folders in relative path, top level file has depth 1
+func depth(rel string) int {
+	return strings.Count(filepath.ToSlash(rel), "/") + 1
+}
+
+// readTokens reads file by analyzer and returns its tokens and hash of content,
+// file with too long words is indexed without them
+func readTokens(root, name string, analyzer Analyzer) ([]Token, string, error) {
+	file, err := os.Open(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	tokens, err := analyzer.Analyze(io.TeeReader(file, hash))
+	if err == ErrWordTooLong {
+		log.Warn().Err(err).Str("File", name).Msg("File is indexed without long words")
+	} else if err != nil {
+		return nil, "", err
+	}
+	return tokens, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashFile returns hash of file content
+func hashFile(root, name string) (string, error) {
+	file, err := os.Open(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readFile reads and tokenizes file. Files known with the same hash of content aren't tokenized,
+// their length is taken from the known document and tokens are nil
+func readFile(root string, path walkedFile, analyzer Analyzer, known func(name string) (Document, bool)) (fileData, error) {
+	if doc, ok := known(path.name); ok {
+		hash, err := hashFile(root, path.name)
+		if err != nil {
+			return fileData{}, err
+		}
+		if hash == doc.Hash {
+			return fileData{name: path.name, doc: newDocument(path.info, hash, doc.Length)}, nil
+		}
+	}
+	tokens, hash, err := readTokens(root, path.name, analyzer)
+	if err != nil {
+		return fileData{}, err
+	}
+	return fileData{name: path.name, tokens: tokens, doc: newDocument(path.info, hash, len(tokens))}, nil
+}
+
+// processFolder reads and tokenizes all files of folder with bounded pool of workers
+func processFolder(root string, opts Options, handle func(worker int, file fileData) error) error {
+	return processFiles(root, opts, Manifest(nil).document, func(send func(name string, info os.FileInfo) error) error {
+		return walkFiles(root, opts.MaxDepth, send)
+	}, handle)
+}
+
+// processFiles reads and tokenizes files sent by walk with bounded pool of workers, files known
+// with the same content aren't tokenized, see readFile.
+// handle is called from the worker goroutines, worker is number of goroutine from 0 to opts.Workers-1.
+// send waits while all workers are busy, so only opts.Workers files are open at once.
+// The first error stops the processing and is returned
+func processFiles(root string, opts Options, known func(name string) (Document, bool), walk func(send func(name string, info os.FileInfo) error) error,
+	handle func(worker int, file fileData) error) error {
+	workers := opts.workers()
+	analyzer := opts.analyzer()
+	paths := make(chan walkedFile, workers)
+	done := make(chan struct{})
+
+	var once sync.Once
+	var processErr error
+	stop := func(err error) {
+		once.Do(func() {
+			processErr = err
+			close(done)
+		})
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for path := range paths {
+				select {
+				case <-done:
+					continue
+				default:
+				}
+				file, err := readFile(root, path, analyzer, known)
+				if err == nil {
+					err = handle(worker, file)
+				}
+				if err != nil {
+					stop(err)
+				}
+			}
+		}(i)
+	}
+
+	err := walk(func(name string, info os.FileInfo) error {
+		select {
+		case paths <- walkedFile{name: name, info: info}:
+			return nil
+		case <-done:
+			return errStopped
+		}
+	})
+	close(paths)
+	wg.Wait()
+
+	if processErr != nil {
+		return processErr
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func makeFolder(t testing.TB, files map[string]string) string {
+	root, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(text), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestListFiles(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt":       "cup of tea",
+		"a/2.txt":     "cup of tea",
+		"a/b/3.txt":   "cup of tea",
+		"a/b/c/4.txt": "cup of tea",
+	})
+	defer os.RemoveAll(root)
+
+	cases := []struct {
+		maxDepth int
+		expect   []string
+	}{
+		{0, []string{"1.txt", "a/2.txt", "a/b/3.txt", "a/b/c/4.txt"}},
+		{1, []string{"1.txt"}},
+		{3, []string{"1.txt", "a/2.txt", "a/b/3.txt"}},
+	}
+	for _, c := range cases {
+		actual, err := listFiles(root, c.maxDepth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(actual)
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("depth %v: %v isn't equal to expected %v", c.maxDepth, actual, c.expect)
+		}
+	}
+}
+
+func TestIndexingFolder(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt":     "cup of\ntea",
+		"dir/2.txt": "black  tea",
+	})
+	defer os.RemoveAll(root)
+
+	expect := ReverseIndex{
+		"black": []WordIndex{
+			WordIndex{"dir/2.txt", []int{0}, []Span{{0, 5, 1}}},
+		},
+		"cup": []WordIndex{
+			WordIndex{"1.txt", []int{0}, []Span{{0, 3, 1}}},
+		},
+		"tea": []WordIndex{
+			WordIndex{"1.txt", []int{2}, []Span{{7, 3, 2}}},
+			WordIndex{"dir/2.txt", []int{1}, []Span{{7, 3, 1}}},
+		},
+	}
+
+	for _, workers := range []int{1, 4} {
+		actual, err := IndexingFolderWith(root, Options{Workers: workers})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("workers %v:\n%v isn't equal to expected\n%v", workers, actual, expect)
+		}
+	}
+}
+
+func TestIndexingFolderError(t *testing.T) {
+	if _, err := IndexingFolderWith(filepath.Join(os.TempDir(), "doesn't exist"), Options{Workers: 2}); err == nil {
+		t.Error("indexing of missing folder didn't return error")
+	}
+}
+
+func BenchmarkIndexingFolder(b *testing.B) {
+	words := []string{"cup", "black", "tea", "coffee", "milk", "sugar", "spoon", "table", "kitchen", "morning"}
+	files := map[string]string{}
+	size := 0
+	for i := 0; i < 100; i++ {
+		var text strings.Builder
+		for j := 0; j < 1000; j++ {
+			text.WriteString(words[(i*7+j*j)%len(words)])
+			text.WriteString(" ")
+		}
+		files[fmt.Sprintf("dir%v/%v.txt", i%10, i)] = text.String()
+		size += text.Len()
+	}
+	root := makeFolder(b, files)
+	defer os.RemoveAll(root)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%v", workers), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				if _, err := IndexingFolderWith(root, Options{Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -1,259 +1,418 @@
 package index
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
-	"unicode"
 
 	"github.com/go-pg/pg/v9"
-	"github.com/kljensen/snowball/english"
 	"github.com/polisgo2020/search-tarival/model"
 	"github.com/rs/zerolog/log"
-	"github.com/zoomio/stopwords"
 )
 
 // indexing
 
-// WordIndex - part index for positions word in one file
+// WordIndex - part index for positions word in one file, Spans are places of the word in file for every position.
+// Indexes written before spans were added have no Spans
 type WordIndex struct {
 	File      string
 	Positions []int
+	Spans     []Span `json:",omitempty"`
 }
 
 // ReverseIndex is type for storage reverse index in program
 type ReverseIndex map[string][]WordIndex
 
-type fileData struct {
-	name string
-	text []byte
+// jsonFormat starts json index with manifest, older json files contain only ReverseIndex
+const jsonFormat = `{"Format":"reverse-index"`
+
+type indexJSON struct {
+	Format   string
+	Version  int
+	Root     string
+	Analyzer string
+	MaxDepth int `json:",omitempty"`
+	Manifest Manifest
+	Words    ReverseIndex
+	Forms    map[string]string `json:",omitempty"`
 }
 
 // ReadIndexJSON - read 'pathToIndex' file and return ReverseIndex
 func ReadIndexJSON(pathToIndex string) (ReverseIndex, error) {
+	idx, err := readIndexJSON(pathToIndex)
+	if err != nil {
+		return nil, err
+	}
+	return idx.Words, nil
+}
+
+func readIndexJSON(pathToIndex string) (*Index, error) {
 	file, err := ioutil.ReadFile(pathToIndex)
 	if err != nil {
 		return nil, err
 	}
 
-	index := make(ReverseIndex)
-	if err := json.Unmarshal(file, &index); err != nil {
+	if !bytes.HasPrefix(file, []byte(jsonFormat)) {
+		index := make(ReverseIndex)
+		if err := json.Unmarshal(file, &index); err != nil {
+			return nil, err
+		}
+		return &Index{
+			Analyzer: DefaultAnalyzer,
+			Manifest: make(Manifest),
+			Words:    index,
+		}, nil
+	}
+
+	data := indexJSON{}
+	if err := json.Unmarshal(file, &data); err != nil {
 		return nil, err
 	}
-	return index, nil
+	if data.Manifest == nil {
+		data.Manifest = make(Manifest)
+	}
+	if data.Words == nil {
+		data.Words = make(ReverseIndex)
+	}
+	if data.Analyzer == "" {
+		data.Analyzer = DefaultAnalyzer
+	}
+	return &Index{
+		Root:     data.Root,
+		Analyzer: data.Analyzer,
+		MaxDepth: data.MaxDepth,
+		Manifest: data.Manifest,
+		Words:    data.Words,
+		Forms:    data.Forms,
+	}, nil
 }
 
-// HandleWords - convert words to correct tokens. Trim, ToLower, Stemmer and exception stop words
+// WriteJSON writes index with manifest to w in json format
+func (idx *Index) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(indexJSON{
+		Format:   "reverse-index",
+		Version:  1,
+		Root:     idx.Root,
+		Analyzer: idx.Analyzer,
+		MaxDepth: idx.MaxDepth,
+		Manifest: idx.Manifest,
+		Words:    idx.Words,
+		Forms:    idx.Forms,
+	})
+}
+
+// HandleWords - convert words to correct tokens. Split by punctuation, Trim, ToLower, Stemmer and exception stop words
 func HandleWords(words []string) []string {
 	var tokens []string
 	for _, word := range words {
-		word = strings.TrimFunc(word, func(r rune) bool {
-			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		englishAnalyzer.tokenizer.Tokenize(strings.NewReader(word), func(word string, _ Span) {
+			if token, ok := englishAnalyzer.filter(word); ok {
+				tokens = append(tokens, token)
+			}
 		})
-		word = strings.ToLower(word)
-		word = english.Stem(word, false)
+	}
+	return tokens
+}
 
-		if stopwords.IsStopWord(word) || word == "" {
+// addFileInIndex adds tokens of file to index. Index isn't locked, every indexing worker fills its own shard
+func (index ReverseIndex) addFileInIndex(fileName string, tokens []Token) {
+	for _, token := range tokens {
+		word := token.Text
+		// all tokens of file are added together, so the file can be only the last in word's slice
+		if sliceIndex := index[word]; len(sliceIndex) != 0 && sliceIndex[len(sliceIndex)-1].File == fileName {
+			j := len(sliceIndex) - 1
+			index[word][j].Positions = append(index[word][j].Positions, token.Position)
+			index[word][j].Spans = append(index[word][j].Spans, token.Span)
 			continue
 		}
-		word = strings.Replace(word, "'", "", 1)
-		tokens = append(tokens, word)
+		item := WordIndex{
+			File:      fileName,
+			Positions: []int{token.Position},
+			Spans:     []Span{token.Span},
+		}
+		index[word] = append(index[word], item)
 	}
-	return tokens
 }
 
-func readFile(path, fileName string, ch chan<- fileData, errCh chan<- error) {
-	fileText, err := ioutil.ReadFile(path + string(os.PathSeparator) + fileName)
-	if err != nil {
-		errCh <- err
-		return
-	}
-	file := fileData{
-		name: fileName,
-		text: fileText,
+// IndexingFolder create a reverse index for all files in folder and its subfolders.
+//
+// Deprecated: use IndexingFolderWith
+func IndexingFolder(path string) (ReverseIndex, error) {
+	return IndexingFolderWith(path, Options{})
+}
+
+// IndexingFolderWith create a reverse index for all files in folder and its subfolders by opts.
+// Files are stored by path relative to folder
+func IndexingFolderWith(path string, opts Options) (ReverseIndex, error) {
+	idx := NewIndex(path)
+	if _, err := idx.Update(opts); err != nil {
+		return nil, err
 	}
-	ch <- file
+	return idx.Words, nil
 }
 
-func deleteDirs(files []os.FileInfo) []os.FileInfo {
-	i := 0
-	for _, file := range files {
-		if !file.IsDir() {
-			files[i] = file
-			i++
+// mergeIndexes joins shards built by indexing workers into the first shard.
+// Every file is indexed by one worker, so shards have no common files.
+// Files of every word of the first shard must be sorted by name, only words of other shards
+// are sorted again, so the result doesn't depend on the order of work
+func mergeIndexes(shards []ReverseIndex) ReverseIndex {
+	if len(shards) == 0 {
+		return make(ReverseIndex)
+	}
+	index := shards[0]
+	merged := map[string]bool{}
+	for _, shard := range shards[1:] {
+		for word, sliceIndex := range shard {
+			index[word] = append(index[word], sliceIndex...)
+			merged[word] = true
 		}
 	}
-	files = files[:i]
-	return files
-}
-
-func (index ReverseIndex) addFileInIndex(fileName string, fileText string, mu *sync.Mutex, wg *sync.WaitGroup) {
-	defer wg.Done()
-	words := strings.Fields(string(fileText))
-	tokens := HandleWords(words)
-	wordPosition := 0
-	mu.Lock()
-	for _, word := range tokens {
-		if sliceIndex, ok := index[word]; ok {
-			if j := HasFileInIndex(sliceIndex, fileName); j != -1 {
-				index[word][j].Positions = append(index[word][j].Positions, wordPosition)
-				wordPosition++
-				continue
+	for word := range merged {
+		sliceIndex := index[word]
+		sort.Slice(sliceIndex, func(i, j int) bool { return sliceIndex[i].File < sliceIndex[j].File })
+	}
+	return index
+}
+
+// addFileInDB saves tokens of file and state of file, positions of file indexed before are replaced.
+// All changes are made in one transaction, so failed indexing keeps the previous state of file
+func addFileInDB(db *pg.DB, fileName string, doc Document, tokens []Token) error {
+	err := db.RunInTransaction(func(tx *pg.Tx) error {
+		file := fileDB(fileName, doc)
+		ok, err := file.CheckAndInsert(tx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err = model.Delete(tx, "positions", "f_id", strconv.Itoa(file.Id)); err != nil {
+				return err
+			}
+			id := file.Id
+			file = fileDB(fileName, doc)
+			file.Id = id
+			if err = file.UpdateState(tx); err != nil {
+				return err
 			}
 		}
-		item := WordIndex{
-			File:      fileName,
-			Positions: []int{wordPosition},
+
+		words, err := model.SelectWords(tx)
+		if err != nil {
+			return err
 		}
-		index[word] = append(index[word], item)
-		wordPosition++
-	}
-	mu.Unlock()
-}
 
-func readDirInChan(path string, ch chan<- fileData, errCh chan<- error) (int, error) {
-	files, err := ioutil.ReadDir(path)
+		var buffer []model.Position
+		for _, token := range tokens {
+			if _, ok := words[token.Text]; !ok {
+				word := model.Word{
+					Word: token.Text,
+				}
+				_, err = word.CheckAndInsert(tx)
+				if err != nil {
+					return err
+				}
+				words[word.Word] = word.Id
+			}
+			buffer = append(buffer, model.Position{
+				Wid:      words[token.Text],
+				Fid:      file.Id,
+				Position: token.Position + 1,
+				Offset:   token.Span.Offset,
+				Length:   token.Span.Length,
+				Line:     token.Span.Line,
+				Form:     token.surface(),
+			})
+		}
+		if len(buffer) == 0 {
+			return nil
+		}
+		return model.Insert(tx, buffer)
+	})
 	if err != nil {
-		return 0, err
+		return err
 	}
+	log.Info().Str("File", fileName).Msg("File is indexed")
+	return nil
+}
 
-	files = deleteDirs(files)
-
-	for _, file := range files {
-		go readFile(path, file.Name(), ch, errCh)
+// fileDB returns row of file in db with state of file
+func fileDB(name string, doc Document) model.File {
+	return model.File{
+		File:    name,
+		Length:  doc.Length,
+		Size:    doc.Size,
+		ModTime: doc.ModTime,
+		Hash:    doc.Hash,
 	}
-	return len(files), nil
 }
 
-// IndexingFolder create a file with reverse index
-func IndexingFolder(path string) (ReverseIndex, error) {
-	ch := make(chan fileData)
-	errCh := make(chan error)
-	defer close(ch)
-	defer close(errCh)
-
-	countFiles, err := readDirInChan(path, ch, errCh)
+// manifestDB returns state of files indexed in db. Files indexed before their state was saved
+// have no hash, so they are indexed again on changes check
+func manifestDB(db *pg.DB) (Manifest, error) {
+	files, err := model.SelectFileStates(db)
 	if err != nil {
 		return nil, err
 	}
-
-	index := make(ReverseIndex)
-	mu := &sync.Mutex{}
-	wg := &sync.WaitGroup{}
-
-	for i := 0; i != countFiles; {
-		select {
-		case file := <-ch:
-			wg.Add(1)
-			go index.addFileInIndex(file.name, string(file.text), mu, wg)
-			i++
-		case err := <-errCh:
-			return nil, err
-		}
+	manifest := make(Manifest, len(files))
+	for _, file := range files {
+		manifest[file.File] = fileDocument(file)
 	}
-	wg.Wait()
-	return index, nil
+	return manifest, nil
 }
 
-func addFileInDB(db *pg.DB, fileName string, fileText string) error {
-	file := model.File{
-		File: fileName,
+// fileDocument returns state of file saved in db
+func fileDocument(file model.File) Document {
+	return Document{
+		Size:    file.Size,
+		ModTime: file.ModTime,
+		Hash:    file.Hash,
+		Length:  file.Length,
 	}
+}
 
-	ok, err := file.CheckAndInsert(db)
-	if err != nil {
+// IndexingFolderDB save reverse index for folder and its subfolders in db.
+//
+// Deprecated: use IndexingFolderDBWith
+func IndexingFolderDB(db *pg.DB, path string) error {
+	return IndexingFolderDBWith(db, path, Options{})
+}
+
+// IndexingFolderDBWith save reverse index for folder and its subfolders in db by opts
+func IndexingFolderDBWith(db *pg.DB, path string, opts Options) error {
+	if err := checkAnalyzerDB(db, opts.analyzer().Name()); err != nil {
 		return err
 	}
-	if !ok {
-		if err = model.Delete(db, "positions", "f_id", strconv.Itoa(file.Id)); err != nil {
-			return err
-		}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
 	}
-
-	tokens := HandleWords(strings.Fields(string(fileText)))
-	wordPosition := 1
-
-	words, err := model.SelectWords(db)
-	if err != nil {
+	root := model.Meta{
+		Key:   "root",
+		Value: path,
+	}
+	if err := root.Save(db); err != nil {
 		return err
 	}
-
-	var buffer []model.Position
-	for _, token := range tokens {
-		if _, ok := words[token]; !ok {
-			word := model.Word{
-				Word: token,
-			}
-			_, err = word.CheckAndInsert(db)
-			if err != nil {
-				return err
-			}
-			words[word.Word] = word.Id
-		}
-		buffer = append(buffer, model.Position{
-			Wid:      words[token],
-			Fid:      file.Id,
-			Position: wordPosition,
-		})
-		wordPosition++
+	depth := model.Meta{
+		Key:   "depth",
+		Value: strconv.Itoa(opts.MaxDepth),
 	}
-	if err := model.Insert(db, buffer); err != nil {
+	if err := depth.Save(db); err != nil {
 		return err
 	}
-	log.Info().Str("File", fileName).Msg("File is indexed")
-	return nil
+	mu := &sync.Mutex{}
+	return processFolder(path, opts, func(_ int, file fileData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return addFileInDB(db, file.name, file.doc, file.tokens)
+	})
 }
 
-func readDir(path string) ([]fileData, error) {
-	files, err := ioutil.ReadDir(path)
-	if err != nil {
-		return nil, err
+// AnalyzerDB returns name of analyzer used for index in db
+func AnalyzerDB(db *pg.DB) (string, error) {
+	meta := model.Meta{
+		Key: "analyzer",
 	}
+	if err := meta.SelectRow(db); err != nil {
+		if err == pg.ErrNoRows {
+			return DefaultAnalyzer, nil
+		}
+		return "", err
+	}
+	return meta.Value, nil
+}
 
-	files = deleteDirs(files)
-
-	ch := make(chan fileData)
-	defer close(ch)
-	errCh := make(chan error)
-	defer close(errCh)
-	for _, file := range files {
-		go readFile(path, file.Name(), ch, errCh)
+// RootDB returns indexed folder of index in db, empty string is returned if it isn't saved
+func RootDB(db *pg.DB) (string, error) {
+	meta := model.Meta{
+		Key: "root",
 	}
-	var filesData []fileData
-	for i := 0; i != len(files); {
-		select {
-		case err = <-errCh:
-			return nil, err
-		case file := <-ch:
-			filesData = append(filesData, file)
-			i++
+	if err := meta.SelectRow(db); err != nil {
+		if err == pg.ErrNoRows {
+			return "", nil
 		}
+		return "", err
 	}
-	return filesData, nil
+	return meta.Value, nil
 }
 
-// IndexingFolderDB save reverse index in db
-func IndexingFolderDB(db *pg.DB, path string) error {
-	files, err := readDir(path)
-	if err != nil {
-		return err
+// depthDB returns max depth of subfolders of index in db, 0 is returned if it isn't saved
+func depthDB(db *pg.DB) (int, error) {
+	meta := model.Meta{
+		Key: "depth",
+	}
+	if err := meta.SelectRow(db); err != nil {
+		if err == pg.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
 	}
+	return strconv.Atoi(meta.Value)
+}
 
-	for _, file := range files {
-		if err := addFileInDB(db, file.name, string(file.text)); err != nil {
+// schemaDB is columns of tables of index in db
+var schemaDB = []struct {
+	table   string
+	columns []string
+}{
+	{"words", []string{"w_id", "word"}},
+	{"files", []string{"f_id", "name_file", "length", "size", "mod_time", "hash"}},
+	{"positions", []string{"w_id", "f_id", "position", "byte_offset", "length", "line", "form"}},
+	{"meta", []string{"key", "value"}},
+}
+
+// CheckSchemaDB returns error if tables of db are created by older version of db-index.sql
+// or fuzzystrmatch extension isn't installed. db-migrate.sql updates such db
+func CheckSchemaDB(db *pg.DB) error {
+	for _, schema := range schemaDB {
+		columns, err := model.SelectColumns(db, schema.table)
+		if err != nil {
 			return err
 		}
+		for _, column := range schema.columns {
+			if !contains(columns, column) {
+				return fmt.Errorf("Column %s.%s isn't found in db, apply db-migrate.sql or create db by db-index.sql and index folder again",
+					schema.table, column)
+			}
+		}
+	}
+	ok, err := model.HasExtension(db, "fuzzystrmatch")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("Extension fuzzystrmatch isn't installed in db, apply db-migrate.sql")
 	}
 	return nil
 }
 
-// HasFileInIndex find in slice WordIndexs file and returning index for slice item with file
+// checkAnalyzerDB saves name of analyzer for index in db or compares it with saved name
+func checkAnalyzerDB(db *pg.DB, name string) error {
+	meta := model.Meta{
+		Key:   "analyzer",
+		Value: name,
+	}
+	if _, err := meta.CheckAndInsert(db); err != nil {
+		return err
+	}
+	return CheckAnalyzer(meta.Value, name)
+}
+
+// HasFileInIndex find in slice WordIndexs file and returning index for slice item with file.
+//
+// Deprecated: it isn't used by index anymore and is kept for compatibility
 func HasFileInIndex(sliceIndex []WordIndex, fileName string) int {
+	return hasFileInIndex(sliceIndex, fileName)
+}
+
+// hasFileInIndex find in slice WordIndexs file and returning index for slice item with file
+func hasFileInIndex(sliceIndex []WordIndex, fileName string) int {
 	for i, indexWord := range sliceIndex {
 		if indexWord.File == fileName {
 			return i
@@ -269,34 +428,127 @@ type searchResult struct {
 	uniqueKeywords  int
 	maxLengthPhrase int
 	words           []wordOnFile
+	fuzzy           bool
 }
 
 type wordOnFile struct {
 	word     string
 	position int
+	span     Span
+}
+
+// Searcher is storage of reverse index returning ranked results of search phrase.
+// It's implemented by ReverseIndex and every Store
+type Searcher interface {
+	Search(searchPhrase string, opts SearchOptions) (Results, error)
 }
 
+var (
+	_ Searcher = ReverseIndex(nil)
+	_ Searcher = (*Index)(nil)
+	_ Searcher = (*Segment)(nil)
+	_ Searcher = (*DB)(nil)
+)
+
 // Searching is func for search with reverse index
 func (index ReverseIndex) Searching(searchPhrase string) ([]string, error) {
-	keywords := strings.Fields(searchPhrase)
-	keywords = HandleWords(keywords)
+	results, err := index.Search(searchPhrase, SearchOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return results.Files(), nil
+}
+
+// Search is func for search with reverse index returning ranked results, words of index
+// must be analyzed by DefaultAnalyzer. Dictionary of index is built only for wildcard and fuzzy terms,
+// it's cached for the last searched index, see ReverseIndex.dictionary
+func (index ReverseIndex) Search(searchPhrase string, opts SearchOptions) (Results, error) {
+	src := source{
+		lookup: index.lookup,
+		expand: func(pattern string, limit int) ([]string, error) {
+			return index.dictionary().Expand(pattern, limit)
+		},
+		fuzzy: func(word string, distance, limit int) ([]string, error) {
+			return index.dictionary().Fuzzy(word, distance, limit)
+		},
+	}
+	return search(src, englishAnalyzer, searchPhrase, opts, newCollection(nil))
+}
+
+func (index ReverseIndex) lookup(word string) ([]WordIndex, error) {
+	return index[word], nil
+}
+
+// searching is func for search with any storage of reverse index.
+// Search phrase is parsed as query and its words are converted to keywords by the analyzer of index,
+// positions of all variants of keyword are counted as positions of the keyword.
+// Found files are ranked by opts with statistics of docs
+func searching(src source, analyzer Analyzer, searchPhrase string, opts SearchOptions, docs collection) ([]string, error) {
+	results, err := search(src, analyzer, searchPhrase, opts, docs)
+	if err != nil {
+		return nil, err
+	}
+	return results.Files(), nil
+}
+
+// search is searching returning ranked matches with keywords of search phrase
+func search(src source, analyzer Analyzer, searchPhrase string, opts SearchOptions, docs collection) (Results, error) {
+	q, err := analyzeQuery(analyzer, src, searchPhrase, opts.maxExpansions(), 0)
+	if err != nil {
+		return Results{}, err
+	}
+	results, err := searchQuery(src, q, opts, docs)
+	if err != nil || len(results.Matches) != 0 || opts.AutoFuzzy == 0 {
+		return results, err
+	}
+
+	// nothing is found, so words of search phrase are searched as typos
+	q, err = analyzeQuery(analyzer, src, searchPhrase, opts.maxExpansions(), opts.AutoFuzzy)
+	if err != nil {
+		return Results{}, err
+	}
+	return searchQuery(src, q, opts, docs)
+}
 
-	if len(keywords) == 0 {
-		return nil, errors.New("Search phrase doesn't contain right keywords")
+// searchQuery finds files matching analyzed query and ranks them.
+// Files matching any keyword only by fuzzy variants are marked as fuzzy
+func searchQuery(src source, q query, opts SearchOptions, docs collection) (Results, error) {
+	p := newPostings(src.lookup)
+	matched, _, err := p.match(q, q.root)
+	if err != nil {
+		return Results{}, err
 	}
 
 	results := map[string]searchResult{}
+	df := map[string]int{}
 
-	for _, keyword := range keywords {
-		if keywordIndex, ok := index[keyword]; ok {
-			for _, indexFile := range keywordIndex {
+	for i, keyword := range q.keywords {
+		keywordFiles := map[string]bool{}
+		exactFiles := map[string]bool{}
+		for _, variant := range q.variants[i] {
+			variantIndex, err := p.keyword([]string{variant})
+			if err != nil {
+				return Results{}, err
+			}
+			for _, indexFile := range variantIndex {
+				keywordFiles[indexFile.File] = true
+				if !q.fuzzy[i][variant] {
+					exactFiles[indexFile.File] = true
+				}
+				if !matched[indexFile.File] {
+					continue
+				}
 				var words []wordOnFile
 
-				for _, position := range indexFile.Positions {
-					words = append(words, wordOnFile{
+				for j, position := range indexFile.Positions {
+					word := wordOnFile{
 						word:     keyword,
 						position: position,
-					})
+					}
+					if j < len(indexFile.Spans) {
+						word.span = indexFile.Spans[j]
+					}
+					words = append(words, word)
 				}
 
 				if _, ok := results[indexFile.File]; !ok {
@@ -313,92 +565,106 @@ func (index ReverseIndex) Searching(searchPhrase string) ([]string, error) {
 				}
 			}
 		}
+		df[keyword] = len(keywordFiles)
+		for file := range keywordFiles {
+			if result, ok := results[file]; ok && !exactFiles[file] {
+				result.fuzzy = true
+				results[file] = result
+			}
+		}
 	}
 
-	searchResult := handleResults(results, keywords)
-
-	return searchResult, nil
+	return Results{
+		Keywords: q.keywords,
+		Matches:  rankResults(results, q, df, p.closeness, docs, opts),
+	}, nil
 }
 
-// SearchingDB is func for search with reverse index
+// SearchingDB is func for search with reverse index in db by analyzer saved in db.
+//
+// Deprecated: use SearchingDBWith
 func SearchingDB(db *pg.DB, searchPhrase string) ([]string, error) {
-	keywords := strings.Fields(searchPhrase)
-	keywords = HandleWords(keywords)
+	name, err := AnalyzerDB(db)
+	if err != nil {
+		return nil, err
+	}
+	analyzer, err := AnalyzerByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return SearchingDBWith(db, analyzer, searchPhrase, SearchOptions{})
+}
 
-	if len(keywords) == 0 {
-		return nil, errors.New("Search phrase doesn't contain right keywords")
+// SearchingDBWith is func for search with reverse index in db, analyzer must be the same as for indexing.
+// Found files are ranked by opts
+func SearchingDBWith(db *pg.DB, analyzer Analyzer, searchPhrase string, opts SearchOptions) ([]string, error) {
+	results, err := SearchDB(db, analyzer, searchPhrase, opts)
+	if err != nil {
+		return nil, err
 	}
+	return results.Files(), nil
+}
 
-	results := map[string]searchResult{}
+// SearchDB is func for search with reverse index in db returning ranked matches
+func SearchDB(db *pg.DB, analyzer Analyzer, searchPhrase string, opts SearchOptions) (Results, error) {
 	files, err := model.SelectFiles(db)
 	if err != nil {
-		return nil, err
+		return Results{}, err
+	}
+	fileLengths, err := model.SelectFileLengths(db)
+	if err != nil {
+		return Results{}, err
 	}
+	lengths := make(map[string]int, len(fileLengths))
+	for id, length := range fileLengths {
+		lengths[files[id]] = length
+	}
+	src, err := sourceDB(db, files)
+	if err != nil {
+		return Results{}, err
+	}
+	return search(src, analyzer, searchPhrase, opts, newCollection(lengths))
+}
 
-	for _, keyword := range keywords {
+// lookupDB returns func finding files and positions of word in db, files is names of files by id.
+// Positions in db start from 1, they are converted to positions starting from 0
+func lookupDB(db *pg.DB, files map[int]string) func(word string) ([]WordIndex, error) {
+	return func(keyword string) ([]WordIndex, error) {
 		word := model.Word{
 			Word: keyword,
 		}
-		switch err := word.SelectRow(db); err {
-		case nil:
-		default:
-			if err.Error() == "pg: no rows in result set" {
-				continue
-			} else {
-				return nil, err
+		if err := word.SelectRow(db); err != nil {
+			if err == pg.ErrNoRows {
+				return nil, nil
 			}
+			return nil, err
 		}
-
 		positions, err := model.SelectPositions(db, word.Id)
 		if err != nil {
 			return nil, err
 		}
-		for _, position := range positions {
-			word := wordOnFile{
-				word:     keyword,
-				position: position.Position,
+		sort.Slice(positions, func(i, j int) bool {
+			if positions[i].Fid != positions[j].Fid {
+				return positions[i].Fid < positions[j].Fid
 			}
+			return positions[i].Position < positions[j].Position
+		})
 
-			if _, ok := results[files[position.Fid]]; !ok {
-				results[files[position.Fid]] = searchResult{
-					count:          1,
-					uniqueKeywords: 0,
-					words:          []wordOnFile{word},
-				}
-			} else {
-				result := results[files[position.Fid]]
-				result.count++
-				result.words = append(result.words, word)
-				results[files[position.Fid]] = result
+		var sliceIndex []WordIndex
+		for _, position := range positions {
+			if n := len(sliceIndex); n == 0 || sliceIndex[n-1].File != files[position.Fid] {
+				sliceIndex = append(sliceIndex, WordIndex{File: files[position.Fid]})
 			}
+			item := &sliceIndex[len(sliceIndex)-1]
+			item.Positions = append(item.Positions, position.Position-1)
+			item.Spans = append(item.Spans, Span{
+				Offset: position.Offset,
+				Length: position.Length,
+				Line:   position.Line,
+			})
 		}
+		return sliceIndex, nil
 	}
-
-	searchResult := handleResults(results, keywords)
-
-	return searchResult, nil
-}
-
-func handleResults(results map[string]searchResult, keywords []string) []string {
-	counterUniqueKeywords(results, keywords)
-	sortPositions(results)
-
-	for file, result := range results {
-		result.maxLengthPhrase = maxLengthSearchPhrase(result.words, keywords)
-		results[file] = result
-	}
-
-	sliceResults := convertMapToSlice(results)
-
-	sortSearchResults(sliceResults)
-
-	var searchResult []string
-
-	for _, result := range sliceResults {
-		searchResult = append(searchResult, result.file)
-	}
-
-	return searchResult
 }
 
 func counterUniqueKeywords(results map[string]searchResult, keywords []string) {
@@ -422,7 +688,9 @@ func sortPositions(results map[string]searchResult) {
 	}
 }
 
-func maxLengthSearchPhrase(words []wordOnFile, keywords []string) int {
+// maxLengthSearchPhrase returns length of the longest part of search phrase in file. Distances between words
+// of the part must be the same as between keywords, positions is positions of keywords in search phrase
+func maxLengthSearchPhrase(words []wordOnFile, keywords []string, positions []int) int {
 	startKeywordPhrasePositon := 0
 	length := 0
 	maxLength := 1
@@ -431,7 +699,8 @@ func maxLengthSearchPhrase(words []wordOnFile, keywords []string) int {
 		if startKeywordPhrasePositon+length >= len(keywords) {
 			return maxLength
 		}
-		if wordData.word == keywords[startKeywordPhrasePositon+length] && wordData.position-1 == prevPosition {
+		next := startKeywordPhrasePositon + length
+		if wordData.word == keywords[next] && (length == 0 || wordData.position-prevPosition == positions[next]-positions[next-1]) {
 			length++
 			if length > maxLength {
 				maxLength = length
@@ -478,6 +747,10 @@ func sortSearchResults(sliceResults []searchResult) {
 		if sliceResults[i].maxLengthPhrase == sliceResults[j].maxLengthPhrase && sliceResults[i].uniqueKeywords == sliceResults[j].uniqueKeywords && sliceResults[i].count > sliceResults[j].count {
 			return true
 		}
+		// files with the same rank are sorted by name, so pages of results don't change between requests
+		if sliceResults[i].maxLengthPhrase == sliceResults[j].maxLengthPhrase && sliceResults[i].uniqueKeywords == sliceResults[j].uniqueKeywords && sliceResults[i].count == sliceResults[j].count {
+			return sliceResults[i].file < sliceResults[j].file
+		}
 		return false
 	})
 }
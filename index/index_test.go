@@ -1,53 +1,160 @@
 package index
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
-	"sync"
+	"strings"
 	"testing"
 )
 
 func TestAddFileInIndex(t *testing.T) {
 	expect := ReverseIndex{
 		"black": []WordIndex{
-			WordIndex{"3.txt", []int{0}},
-			WordIndex{"4.txt", []int{0, 4}},
+			WordIndex{"3.txt", []int{0}, []Span{{0, 5, 1}}},
+			WordIndex{"4.txt", []int{0, 4}, []Span{{0, 5, 1}, {18, 5, 1}}},
 		},
 		"cup": []WordIndex{
-			WordIndex{"1.txt", []int{0}},
-			WordIndex{"2.txt", []int{0}},
+			WordIndex{"1.txt", []int{0}, nil},
+			WordIndex{"2.txt", []int{0}, nil},
 		},
 		"tea": []WordIndex{
-			WordIndex{"1.txt", []int{2}},
-			WordIndex{"2.txt", []int{1}},
-			WordIndex{"3.txt", []int{1}},
-			WordIndex{"4.txt", []int{1, 2, 3}},
+			WordIndex{"1.txt", []int{2}, nil},
+			WordIndex{"2.txt", []int{1}, nil},
+			WordIndex{"3.txt", []int{1}, []Span{{6, 3, 1}}},
+			WordIndex{"4.txt", []int{1, 2, 3}, []Span{{6, 3, 1}, {10, 3, 1}, {14, 3, 1}}},
 		},
 	}
 	actual := ReverseIndex{
 		"cup": []WordIndex{
-			WordIndex{"1.txt", []int{0}},
-			WordIndex{"2.txt", []int{0}},
+			WordIndex{"1.txt", []int{0}, nil},
+			WordIndex{"2.txt", []int{0}, nil},
 		},
 		"tea": []WordIndex{
-			WordIndex{"1.txt", []int{2}},
-			WordIndex{"2.txt", []int{1}},
+			WordIndex{"1.txt", []int{2}, nil},
+			WordIndex{"2.txt", []int{1}, nil},
 		},
 	}
 
-	mu := &sync.Mutex{}
-	wg := &sync.WaitGroup{}
-
 	text := "black tea"
 
-	wg.Add(1)
-	actual.addFileInIndex("3.txt", text, mu, wg)
+	actual.addFileInIndex("3.txt", analyze(t, text))
 
 	text = "black tea tea tea black"
 
-	wg.Add(1)
-	actual.addFileInIndex("4.txt", text, mu, wg)
+	actual.addFileInIndex("4.txt", analyze(t, text))
+
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("\n%v isn't equal to expected\n%v", actual, expect)
+	}
+}
+
+func TestAddFileInIndexStopWords(t *testing.T) {
+	expect := ReverseIndex{
+		"state": []WordIndex{
+			WordIndex{"1.txt", []int{0}, []Span{{0, 5, 1}}},
+		},
+		"art": []WordIndex{
+			WordIndex{"1.txt", []int{3}, []Span{{13, 3, 1}}},
+		},
+	}
+	actual := ReverseIndex{}
+
+	actual.addFileInIndex("1.txt", analyze(t, "State of the art"))
+
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("\n%v isn't equal to expected\n%v", actual, expect)
+	}
+}
+
+func TestSearchingStopWords(t *testing.T) {
+	index := ReverseIndex{}
+	index.addFileInIndex("1.txt", analyze(t, "state art and more art of the state"))
+	index.addFileInIndex("2.txt", analyze(t, "state of the art"))
+
+	expect := []string{"2.txt", "1.txt"}
+	actual, err := index.Searching("state of the art")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+}
+
+// withoutSpans removes spans from index for tests checking only positions
+func withoutSpans(index ReverseIndex) ReverseIndex {
+	for _, sliceIndex := range index {
+		for i := range sliceIndex {
+			sliceIndex[i].Spans = nil
+		}
+	}
+	return index
+}
+
+// openSegment writes index in binary format to temporary file and maps it,
+// the segment is closed and the file is removed at the end of test
+func openSegment(t *testing.T, idx *Index) *Segment {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "index.bin")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.WriteBinary(file); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	segment, err := OpenSegment(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { segment.Close() })
+	return segment
+}
+
+func analyze(t *testing.T, text string) []Token {
+	tokens, err := englishAnalyzer.Analyze(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestMergeIndexes(t *testing.T) {
+	shards := []ReverseIndex{
+		ReverseIndex{
+			"tea": []WordIndex{
+				WordIndex{"2.txt", []int{1}, nil},
+			},
+		},
+		ReverseIndex{
+			"cup": []WordIndex{
+				WordIndex{"1.txt", []int{0}, nil},
+			},
+			"tea": []WordIndex{
+				WordIndex{"3.txt", []int{0}, nil},
+				WordIndex{"1.txt", []int{1}, nil},
+			},
+		},
+	}
+	expect := ReverseIndex{
+		"cup": []WordIndex{
+			WordIndex{"1.txt", []int{0}, nil},
+		},
+		"tea": []WordIndex{
+			WordIndex{"1.txt", []int{1}, nil},
+			WordIndex{"2.txt", []int{1}, nil},
+			WordIndex{"3.txt", []int{0}, nil},
+		},
+	}
 
-	wg.Wait()
+	actual := mergeIndexes(shards)
 
 	if !reflect.DeepEqual(actual, expect) {
 		t.Errorf("\n%v isn't equal to expected\n%v", actual, expect)
@@ -70,8 +177,8 @@ func TestHandleWords(t *testing.T) {
 
 func TestHasFileInIndex(t *testing.T) {
 	in := []WordIndex{
-		WordIndex{"3.txt", []int{0}},
-		WordIndex{"1.txt", []int{1}},
+		WordIndex{"3.txt", []int{0}, nil},
+		WordIndex{"1.txt", []int{1}, nil},
 	}
 	right := "1.txt"
 	wrong := "3.json"
@@ -87,18 +194,18 @@ func TestHasFileInIndex(t *testing.T) {
 func TestSearching(t *testing.T) {
 	index := ReverseIndex{
 		"black": []WordIndex{
-			WordIndex{"3.txt", []int{1}},
-			WordIndex{"2.txt", []int{2}},
+			WordIndex{"3.txt", []int{1}, nil},
+			WordIndex{"2.txt", []int{2}, nil},
 		},
 		"cup": []WordIndex{
-			WordIndex{"1.txt", []int{0}},
-			WordIndex{"2.txt", []int{0}},
-			WordIndex{"3.txt", []int{0}},
+			WordIndex{"1.txt", []int{0}, nil},
+			WordIndex{"2.txt", []int{0}, nil},
+			WordIndex{"3.txt", []int{0}, nil},
 		},
 		"tea": []WordIndex{
-			WordIndex{"1.txt", []int{1}},
-			WordIndex{"2.txt", []int{1}},
-			WordIndex{"3.txt", []int{2}},
+			WordIndex{"1.txt", []int{1}, nil},
+			WordIndex{"2.txt", []int{1}, nil},
+			WordIndex{"3.txt", []int{2}, nil},
 		},
 	}
 	expect := []string{"3.txt", "2.txt", "1.txt"}
@@ -336,7 +443,7 @@ func TestMaxLengthSearchPhrase(t *testing.T) {
 	in := []string{"cup", "black", "tea"}
 
 	for file, result := range actual {
-		result.maxLengthPhrase = maxLengthSearchPhrase(result.words, in)
+		result.maxLengthPhrase = maxLengthSearchPhrase(result.words, in, []int{0, 1, 2})
 		actual[file] = result
 	}
 
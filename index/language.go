@@ -0,0 +1,164 @@
+package index
+
+import (
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/kljensen/snowball/russian"
+	"github.com/zoomio/stopwords"
+)
+
+// Languages of documents supported by multilingual analyzer
+const (
+	English = "english"
+	Russian = "russian"
+)
+
+var russianStopWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Split(stopwords.StopWordsRu, "\n") {
+		if word = strings.TrimSpace(word); word != "" {
+			russianStopWords[word] = true
+		}
+	}
+}
+
+// RussianStemFilter replaces token by its stem
+var RussianStemFilter = FilterFunc(func(token string) (string, bool) {
+	return russian.Stem(token, false), true
+})
+
+// RussianStopWordsFilter drops russian stop words
+var RussianStopWordsFilter = FilterFunc(func(token string) (string, bool) {
+	return token, !russianStopWords[token]
+})
+
+// language is filters of one language and the script of its words
+type language struct {
+	name    string
+	script  *unicode.RangeTable
+	filters []TokenFilter
+}
+
+var languages = []language{
+	{
+		name:    English,
+		script:  unicode.Latin,
+		filters: []TokenFilter{TrimFilter, LowerCaseFilter, EnglishStemFilter, StopWordsFilter, ApostropheFilter},
+	},
+	{
+		name:    Russian,
+		script:  unicode.Cyrillic,
+		filters: []TokenFilter{TrimFilter, LowerCaseFilter, RussianStopWordsFilter, RussianStemFilter},
+	},
+}
+
+// DetectLanguage returns language with the most letters in words, English is returned for words without letters
+func DetectLanguage(words []string) string {
+	counts := make([]int, len(languages))
+	for _, word := range words {
+		for _, r := range word {
+			for i, lang := range languages {
+				if unicode.Is(lang.script, r) {
+					counts[i]++
+					break
+				}
+			}
+		}
+	}
+	best := 0
+	for i, count := range counts {
+		if count > counts[best] {
+			best = i
+		}
+	}
+	return languages[best].name
+}
+
+// multilingual is analyzer detecting language of every document, query is analyzed with all languages
+type multilingual struct {
+	name      string
+	tokenizer Tokenizer
+	chains    map[string]*chain
+}
+
+// NewMultilingualAnalyzer returns analyzer which detects language of document and uses its stemmer
+// and stop words. Words of query are converted to tokens of every language
+func NewMultilingualAnalyzer(name string, tokenizer Tokenizer) Analyzer {
+	m := &multilingual{
+		name:      name,
+		tokenizer: tokenizer,
+		chains:    map[string]*chain{},
+	}
+	for _, lang := range languages {
+		m.chains[lang.name] = &chain{
+			name:      lang.name,
+			tokenizer: tokenizer,
+			filters:   lang.filters,
+		}
+	}
+	return m
+}
+
+func (m *multilingual) Name() string {
+	return m.name
+}
+
+func (m *multilingual) Analyze(r io.Reader) ([]Token, error) {
+	var (
+		words []string
+		spans []Span
+	)
+	err := m.tokenizer.Tokenize(r, func(word string, span Span) {
+		words = append(words, word)
+		spans = append(spans, span)
+	})
+	if err != nil && err != ErrWordTooLong {
+		return nil, err
+	}
+
+	c := m.chains[DetectLanguage(words)]
+	var tokens []Token
+	for i, word := range words {
+		if token, ok := c.filter(word); ok {
+			tokens = append(tokens, Token{Text: token, Position: i, Span: spans[i], Form: surfaceForm(word)})
+		}
+	}
+	return tokens, err
+}
+
+// AnalyzeQuery converts every word to tokens of all languages, the word is dropped if it's a stop word
+// of any language
+func (m *multilingual) AnalyzeQuery(text string) ([]Keyword, error) {
+	var keywords []Keyword
+	position := -1
+	err := m.tokenizer.Tokenize(strings.NewReader(text), func(word string, _ Span) {
+		position++
+		var variants []string
+		for _, lang := range languages {
+			token, ok := m.chains[lang.name].filter(word)
+			if !ok {
+				return
+			}
+			if !contains(variants, token) {
+				variants = append(variants, token)
+			}
+		}
+		keywords = append(keywords, Keyword{Variants: variants, Position: position})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keywords, nil
+}
+
+func contains(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	cases := map[string]string{
+		"Поиск по документам, search": Russian,
+		"Searching of документы":      English,
+		"2020 - 1":                    English,
+	}
+	for text, expect := range cases {
+		if actual := DetectLanguage(strings.Fields(text)); actual != expect {
+			t.Errorf("%q: %v isn't equal to expected %v", text, actual, expect)
+		}
+	}
+}
+
+func TestMultilingualAnalyzer(t *testing.T) {
+	analyzer, err := AnalyzerByName("multilingual")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := analyzer.Analyze(strings.NewReader("Поиск по документами и Searching"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Token{
+		{"поиск", 0, Span{0, 10, 1}, "поиск"},
+		{"документ", 2, Span{16, 22, 1}, "документами"},
+		{"searching", 4, Span{42, 9, 1}, "searching"},
+	}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+
+	keywords, err := analyzer.AnalyzeQuery("документами searching the")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectKeywords := []Keyword{{[]string{"документами", "документ"}, 0}, {[]string{"search", "searching"}, 1}}
+	if !reflect.DeepEqual(keywords, expectKeywords) {
+		t.Errorf("%v isn't equal to expected %v", keywords, expectKeywords)
+	}
+}
+
+func TestMultilingualSearching(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"ru.txt": "Быстрый поиск по документам",
+		"en.txt": "Fast searching of documents",
+	})
+	defer os.RemoveAll(root)
+
+	multilingual, err := AnalyzerByName("multilingual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{Analyzer: multilingual}); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string][]string{
+		"поиска документов": []string{"ru.txt"},
+		"searched":          []string{"en.txt"},
+	}
+	for phrase, expect := range cases {
+		actual, err := idx.Searching(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%q: %v isn't equal to expected %v", phrase, actual, expect)
+		}
+	}
+}
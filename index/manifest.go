@@ -0,0 +1,259 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Document is state of indexed file, it is compared with the file on reindexing.
+// Length is count of tokens of file, it's used for ranking
+type Document struct {
+	Size    int64
+	ModTime int64
+	Hash    string
+	Length  int
+}
+
+func newDocument(info os.FileInfo, hash string, length int) Document {
+	return Document{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Hash:    hash,
+		Length:  length,
+	}
+}
+
+// addForms adds indexed words of tokens by their surface forms to forms
+func addForms(forms map[string]string, tokens []Token) {
+	for _, token := range tokens {
+		forms[token.surface()] = token.Text
+	}
+}
+
+// Manifest is indexed files by path relative to the indexed folder
+type Manifest map[string]Document
+
+// document returns state of indexed file
+func (manifest Manifest) document(name string) (Document, bool) {
+	doc, ok := manifest[name]
+	return doc, ok
+}
+
+// Index is reverse index of folder with manifest of indexed files. Forms is indexed words
+// by their surface forms, see Token. Searching is safe while changes of files are applied to index
+type Index struct {
+	Root     string
+	Analyzer string
+	MaxDepth int
+	Manifest Manifest
+	Words    ReverseIndex
+	Forms    map[string]string
+
+	mu     sync.RWMutex
+	dictMu sync.Mutex
+	dict   Dictionary
+	sorted Forms
+}
+
+// Changes is count of files by result of index update
+type Changes struct {
+	Added     int
+	Updated   int
+	Renamed   int
+	Removed   int
+	Unchanged int
+}
+
+// NewIndex returns empty index of folder at root
+func NewIndex(root string) *Index {
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	return &Index{
+		Root:     root,
+		Manifest: make(Manifest),
+		Words:    make(ReverseIndex),
+	}
+}
+
+// Searching is func for search with index, it can be called while index is updated
+func (idx *Index) Searching(searchPhrase string) ([]string, error) {
+	return idx.SearchingWith(searchPhrase, SearchOptions{})
+}
+
+// SearchingWith is func for search with index, found files are ranked by opts
+func (idx *Index) SearchingWith(searchPhrase string, opts SearchOptions) ([]string, error) {
+	results, err := idx.Search(searchPhrase, opts)
+	if err != nil {
+		return nil, err
+	}
+	return results.Files(), nil
+}
+
+// Search is func for search with index returning ranked matches, found files are ranked by opts
+func (idx *Index) Search(searchPhrase string, opts SearchOptions) (Results, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	analyzer, err := AnalyzerByName(idx.Analyzer)
+	if err != nil {
+		return Results{}, err
+	}
+	return search(idx.source(), analyzer, searchPhrase, opts, idx.Manifest.collection())
+}
+
+// Update makes index of folder actual. Only files with other size or modification time than
+// in manifest are read, they are hashed and only files with changed content are tokenized again.
+// Deleted files and files deeper than MaxDepth of opts are removed from index, the depth is saved in index
+func (idx *Index) Update(opts Options) (Changes, error) {
+	idx.MaxDepth = opts.MaxDepth
+	events, err := scanFolder(idx.Root, opts.MaxDepth, idx.Manifest)
+	if err != nil {
+		return Changes{}, err
+	}
+	changes, err := idx.Apply(events, opts)
+	if err != nil {
+		return changes, err
+	}
+	changes.Unchanged = len(idx.Manifest) - changes.Added - changes.Updated - changes.Renamed
+	return changes, nil
+}
+
+// Apply applies changes of files to index. Files are read before index is locked,
+// so searching waits only for changing of words positions.
+// Apply and Update mustn't be called concurrently. Analyzer of opts must be the same as analyzer of index,
+// analyzer of empty index is set by the first Apply
+func (idx *Index) Apply(events Events, opts Options) (Changes, error) {
+	var changes Changes
+	name := opts.analyzer().Name()
+	analyzer := idx.Analyzer
+	if analyzer == "" && len(idx.Manifest) == 0 {
+		analyzer = name
+	}
+	if err := CheckAnalyzer(analyzer, name); err != nil {
+		return changes, err
+	}
+	shards := make([]ReverseIndex, opts.workers())
+	forms := make([]map[string]string, len(shards))
+	files := make([][]fileData, len(shards))
+	for i := range shards {
+		shards[i] = make(ReverseIndex)
+		forms[i] = make(map[string]string)
+	}
+	err := processFiles(idx.Root, opts, idx.Manifest.document, events.sendChanged, func(worker int, file fileData) error {
+		if doc, ok := idx.Manifest[file.name]; !ok || doc.Hash != file.doc.Hash {
+			shards[worker].addFileInIndex(file.name, file.tokens)
+			addForms(forms[worker], file.tokens)
+		}
+		file.tokens = nil
+		files[worker] = append(files[worker], file)
+		return nil
+	})
+	if err != nil {
+		return changes, err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.Analyzer = analyzer
+	removed := map[string]bool{}
+	renamed := map[string]string{}
+	for _, event := range events {
+		switch event.Op {
+		case Delete:
+			removed[event.Name] = true
+			delete(idx.Manifest, event.Name)
+			changes.Removed++
+		case Rename:
+			renamed[event.OldName] = event.Name
+			doc := idx.Manifest[event.OldName]
+			doc.ModTime = event.Info.ModTime().UnixNano()
+			idx.Manifest[event.Name] = doc
+			delete(idx.Manifest, event.OldName)
+			changes.Renamed++
+		}
+	}
+	for _, workerFiles := range files {
+		for _, file := range workerFiles {
+			doc, ok := idx.Manifest[file.name]
+			switch {
+			case !ok:
+				changes.Added++
+			case doc.Hash != file.doc.Hash:
+				removed[file.name] = true
+				changes.Updated++
+			}
+			idx.Manifest[file.name] = file.doc
+		}
+	}
+
+	idx.Words.removeFiles(removed)
+	idx.Words.renameFiles(renamed)
+	idx.Words = mergeIndexes(append([]ReverseIndex{idx.Words}, shards...))
+	idx.mergeForms(forms, len(removed) != 0)
+	idx.dict = nil
+	idx.sorted = nil
+	return changes, nil
+}
+
+// mergeForms adds surface forms of workers to index, forms of removed words are deleted if pruned
+func (idx *Index) mergeForms(forms []map[string]string, prune bool) {
+	if idx.Forms == nil {
+		idx.Forms = make(map[string]string)
+	}
+	if prune {
+		for form, word := range idx.Forms {
+			if _, ok := idx.Words[word]; !ok {
+				delete(idx.Forms, form)
+			}
+		}
+	}
+	for _, workerForms := range forms {
+		for form, word := range workerForms {
+			idx.Forms[form] = word
+		}
+	}
+}
+
+// removeFiles deletes positions of files from index
+func (index ReverseIndex) removeFiles(files map[string]bool) {
+	if len(files) == 0 {
+		return
+	}
+	for word, sliceIndex := range index {
+		i := 0
+		for _, item := range sliceIndex {
+			if !files[item.File] {
+				sliceIndex[i] = item
+				i++
+			}
+		}
+		if i == 0 {
+			delete(index, word)
+		} else {
+			index[word] = sliceIndex[:i]
+		}
+	}
+}
+
+// renameFiles changes names of files in index, files is new names by old names.
+// Only files of words with renamed files are sorted again
+func (index ReverseIndex) renameFiles(files map[string]string) {
+	if len(files) == 0 {
+		return
+	}
+	for _, sliceIndex := range index {
+		renamed := false
+		for i, item := range sliceIndex {
+			if name, ok := files[item.File]; ok {
+				sliceIndex[i].File = name
+				renamed = true
+			}
+		}
+		if renamed {
+			sort.Slice(sliceIndex, func(i, j int) bool { return sliceIndex[i].File < sliceIndex[j].File })
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package index
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIndexUpdate(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt":     "cup of tea",
+		"2.txt":     "black tea",
+		"dir/3.txt": "black coffee",
+		"4.txt":     "milk",
+	})
+	defer os.RemoveAll(root)
+
+	idx := NewIndex(root)
+	changes, err := idx.Update(Options{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (Changes{Added: 4}); changes != expect {
+		t.Errorf("%+v isn't equal to expected %+v", changes, expect)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := ioutil.WriteFile(filepath.Join(root, "1.txt"), []byte("cup of milk"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(root, "1.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(root, "2.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "dir", "3.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "5.txt"), []byte("green tea"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err = idx.Update(Options{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (Changes{Added: 1, Updated: 1, Removed: 1, Unchanged: 2}); changes != expect {
+		t.Errorf("%+v isn't equal to expected %+v", changes, expect)
+	}
+
+	expect := ReverseIndex{
+		"black": []WordIndex{
+			WordIndex{"2.txt", []int{0}, nil},
+		},
+		"cup": []WordIndex{
+			WordIndex{"1.txt", []int{0}, nil},
+		},
+		"green": []WordIndex{
+			WordIndex{"5.txt", []int{0}, nil},
+		},
+		"milk": []WordIndex{
+			WordIndex{"1.txt", []int{2}, nil},
+			WordIndex{"4.txt", []int{0}, nil},
+		},
+		"tea": []WordIndex{
+			WordIndex{"2.txt", []int{1}, nil},
+			WordIndex{"5.txt", []int{1}, nil},
+		},
+	}
+	if !reflect.DeepEqual(withoutSpans(idx.Words), expect) {
+		t.Errorf("\n%v isn't equal to expected\n%v", idx.Words, expect)
+	}
+	if len(idx.Manifest) != 4 || idx.Manifest["2.txt"].ModTime != later.UnixNano() {
+		t.Errorf("manifest %v isn't updated", idx.Manifest)
+	}
+}
+
+// countingAnalyzer counts tokenized files
+type countingAnalyzer struct {
+	Analyzer
+	files int32
+}
+
+func (a *countingAnalyzer) Analyze(r io.Reader) ([]Token, error) {
+	atomic.AddInt32(&a.files, 1)
+	return a.Analyzer.Analyze(r)
+}
+
+func TestIndexUpdateTokenizesChanged(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt": "cup of tea",
+		"2.txt": "black tea",
+	})
+	defer os.RemoveAll(root)
+
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{Workers: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := ioutil.WriteFile(filepath.Join(root, "1.txt"), []byte("cup of milk"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"1.txt", "2.txt"} {
+		if err := os.Chtimes(filepath.Join(root, name), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	analyzer := &countingAnalyzer{Analyzer: englishAnalyzer}
+	changes, err := idx.Update(Options{Workers: 2, Analyzer: analyzer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (Changes{Updated: 1, Unchanged: 1}); changes != expect {
+		t.Errorf("%+v isn't equal to expected %+v", changes, expect)
+	}
+	if analyzer.files != 1 {
+		t.Errorf("%v isn't equal to expected %v", analyzer.files, 1)
+	}
+	if doc := idx.Manifest["2.txt"]; doc.Length != 2 || doc.ModTime != later.UnixNano() {
+		t.Errorf("document %+v isn't updated", doc)
+	}
+}
+
+func TestIndexWrite(t *testing.T) {
+	expect := &Index{
+		Root:     "/data",
+		Analyzer: "simple",
+		Manifest: Manifest{
+			"1.txt": Document{Size: 10, ModTime: 1583000000000000000, Hash: "aa", Length: 3},
+			"2.txt": Document{Size: 0, ModTime: -1, Hash: "bb"},
+		},
+		Words: ReverseIndex{
+			"cup": []WordIndex{
+				WordIndex{"1.txt", []int{0}, nil},
+			},
+		},
+		Forms: map[string]string{"Cup": "cup", "Cups": "cup", "Tea": "tea"},
+	}
+
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writers := map[string]func(*Index, *bytes.Buffer) error{
+		"index.json": func(idx *Index, buf *bytes.Buffer) error { return idx.WriteJSON(buf) },
+		"index.bin":  func(idx *Index, buf *bytes.Buffer) error { return idx.WriteBinary(buf) },
+	}
+	for name, write := range writers {
+		buf := &bytes.Buffer{}
+		if err := write(expect, buf); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+			t.Fatal(err)
+		}
+		actual, err := ReadIndex(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%v:\n%+v isn't equal to expected\n%+v", name, actual, expect)
+		}
+	}
+}
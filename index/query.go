@@ -0,0 +1,980 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Query syntax:
+//
+//	tea cup          files with any of words
+//	tea AND cup      files with both words, AND binds tighter than OR
+//	tea OR cup       files with any of words
+//	NOT tea, -tea    files without word, it must be combined with other words
+//	+tea cup         files with tea, cup is optional and only affects ranking
+//	"cup of tea"     files with words of phrase going one by one, stop words of phrase match any word
+//	tea NEAR/3 cup   files with cup after tea within 3 words, files with closer words are ranked higher
+//	tea AROUND/3 cup files with tea and cup within 3 words in any order
+//	te* wh?te        words matching pattern, star is any characters and question mark is one character
+//	serach~2         words with the same first letter within edit distance 1 or 2 from the word, ~ is the same as ~2.
+//	                 Files found only by such words are ranked after files with the word itself
+//	(tea OR cup) -milk
+//
+// Operators AND, OR, NOT, NEAR and AROUND must be in upper case, otherwise they are usual words.
+// NEAR and AROUND bind tighter than AND and can be used only between keywords and phrases.
+
+// QueryError is error of parsing search query, Pos is byte offset of error in query
+type QueryError struct {
+	Pos int
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("Query error at position %d: %s", e.Pos+1, e.Msg)
+}
+
+// ErrOnlyExcluded is returned for search phrase which has no keywords except excluded ones
+var ErrOnlyExcluded = errors.New("Search phrase contains only excluded keywords")
+
+// ErrNoKeywords is returned for search phrase which has no keywords, e.g. only stop words
+var ErrNoKeywords = errors.New("Search phrase doesn't contain right keywords")
+
+// Node is node of parsed search query: Term, Phrase, Near, And, Or, Not, Required or Group
+type Node interface {
+	String() string
+}
+
+// Term is word of query, it's converted to keywords by analyzer. Term with wildcards
+// is expanded to indexed words, fuzzy term is expanded to indexed words within Fuzzy edit distance.
+// Pos is byte offset of term in query
+type Term struct {
+	Text  string
+	Pos   int
+	Fuzzy int
+}
+
+// Phrase is quoted words of query, it matches files with its keywords at the same distances
+type Phrase struct {
+	Text string
+}
+
+// Near matches files with every node within Distance words from the previous one.
+// Nodes must go in the same order as in query if Ordered is true
+type Near struct {
+	Nodes    []Node
+	Distance int
+	Ordered  bool
+}
+
+// And matches files matching all nodes, Not nodes exclude files
+type And struct {
+	Nodes []Node
+}
+
+// Or matches files matching any of nodes
+type Or struct {
+	Nodes []Node
+}
+
+// Not excludes files matching node, it's allowed in And and Group only
+type Not struct {
+	Node Node
+}
+
+// Required is node of Group which must be matched
+type Required struct {
+	Node Node
+}
+
+// Group is nodes written one by one. Files must match Required nodes and mustn't match Not nodes.
+// Files must match at least one of other nodes if group has no Required nodes
+type Group struct {
+	Nodes []Node
+}
+
+func (t *Term) String() string {
+	if t.Fuzzy > 0 {
+		return t.Text + "~" + strconv.Itoa(t.Fuzzy)
+	}
+	return t.Text
+}
+
+func (n *Phrase) String() string {
+	return `"` + n.Text + `"`
+}
+
+func (n *Near) String() string {
+	return "(" + joinNodes(n.Nodes, " "+n.operator()+" ") + ")"
+}
+
+func (n *Near) operator() string {
+	if n.Ordered {
+		return "NEAR/" + strconv.Itoa(n.Distance)
+	}
+	return "AROUND/" + strconv.Itoa(n.Distance)
+}
+
+func (n *And) String() string {
+	return "(" + joinNodes(n.Nodes, " AND ") + ")"
+}
+
+func (n *Or) String() string {
+	return "(" + joinNodes(n.Nodes, " OR ") + ")"
+}
+
+func (n *Not) String() string {
+	return "-" + n.Node.String()
+}
+
+func (n *Required) String() string {
+	return "+" + n.Node.String()
+}
+
+func (n *Group) String() string {
+	return "(" + joinNodes(n.Nodes, " ") + ")"
+}
+
+func joinNodes(nodes []Node, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = node.String()
+	}
+	return strings.Join(parts, sep)
+}
+
+// kinds of lexemes of query
+type lexemeKind int
+
+const (
+	wordLexeme lexemeKind = iota
+	phraseLexeme
+	andLexeme
+	orLexeme
+	notLexeme
+	nearLexeme
+	aroundLexeme
+	plusLexeme
+	minusLexeme
+	openLexeme
+	closeLexeme
+	endLexeme
+)
+
+type lexeme struct {
+	kind     lexemeKind
+	text     string
+	pos      int
+	distance int
+}
+
+// lexQuery splits query by white spaces, parentheses and quotes. Plus and minus are operators
+// only before word, phrase or parenthesis
+func lexQuery(text string) ([]lexeme, error) {
+	var lexemes []lexeme
+	isSep := func(r rune) bool { return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' }
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		next, _ := utf8.DecodeRuneInString(text[i+size:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			lexemes = append(lexemes, lexeme{kind: openLexeme, text: "(", pos: i})
+			i++
+		case r == ')':
+			lexemes = append(lexemes, lexeme{kind: closeLexeme, text: ")", pos: i})
+			i++
+		case r == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end == -1 {
+				return nil, &QueryError{Pos: len(text), Msg: "closing quote is expected"}
+			}
+			lexemes = append(lexemes, lexeme{kind: phraseLexeme, text: text[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case (r == '+' || r == '-') && i+size < len(text) && !unicode.IsSpace(next) && next != ')':
+			kind := plusLexeme
+			if r == '-' {
+				kind = minusLexeme
+			}
+			lexemes = append(lexemes, lexeme{kind: kind, text: string(r), pos: i})
+			i++
+		default:
+			end := strings.IndexFunc(text[i:], isSep)
+			if end == -1 {
+				end = len(text) - i
+			}
+			word := text[i : i+end]
+			kind := wordLexeme
+			switch word {
+			case "AND":
+				kind = andLexeme
+			case "OR":
+				kind = orLexeme
+			case "NOT":
+				kind = notLexeme
+			}
+			distance := 0
+			for prefix, proximity := range map[string]lexemeKind{"NEAR/": nearLexeme, "AROUND/": aroundLexeme} {
+				if !strings.HasPrefix(word, prefix) {
+					continue
+				}
+				n, err := strconv.Atoi(word[len(prefix):])
+				if err != nil || n < 1 {
+					return nil, &QueryError{Pos: i + len(prefix), Msg: "positive distance is expected after " + prefix}
+				}
+				kind, distance = proximity, n
+			}
+			if tilde := strings.LastIndexByte(word, '~'); kind == wordLexeme && tilde > 0 && isDigits(word[tilde+1:]) {
+				distance = 2
+				if word[tilde+1:] != "" {
+					distance, _ = strconv.Atoi(word[tilde+1:])
+				}
+				if distance < 1 || distance > 2 {
+					return nil, &QueryError{Pos: i + tilde + 1, Msg: "edit distance 1 or 2 is expected after ~"}
+				}
+				word = word[:tilde]
+			}
+			lexemes = append(lexemes, lexeme{kind: kind, text: word, pos: i, distance: distance})
+			i += end
+		}
+	}
+	return append(lexemes, lexeme{kind: endLexeme, pos: len(text)}), nil
+}
+
+// ParseQuery parses search query to tree of nodes
+func ParseQuery(text string) (Node, error) {
+	lexemes, err := lexQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{lexemes: lexemes}
+	node, err := p.group()
+	if err != nil {
+		return nil, err
+	}
+	if l := p.peek(); l.kind != endLexeme {
+		return nil, &QueryError{Pos: l.pos, Msg: "unexpected closing parenthesis"}
+	}
+	return node, nil
+}
+
+type parser struct {
+	lexemes []lexeme
+	i       int
+}
+
+func (p *parser) peek() lexeme {
+	return p.lexemes[p.i]
+}
+
+func (p *parser) next() lexeme {
+	l := p.lexemes[p.i]
+	if l.kind != endLexeme {
+		p.i++
+	}
+	return l
+}
+
+// group parses nodes until closing parenthesis or end of query
+func (p *parser) group() (Node, error) {
+	var nodes []Node
+	for l := p.peek(); l.kind != endLexeme && l.kind != closeLexeme; l = p.peek() {
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	switch len(nodes) {
+	case 0:
+		return nil, &QueryError{Pos: p.peek().pos, Msg: "keywords are expected"}
+	case 1:
+		return nodes[0], nil
+	}
+	return &Group{Nodes: nodes}, nil
+}
+
+func (p *parser) or() (Node, error) {
+	start := p.peek()
+	node, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{node}
+	for p.peek().kind == orLexeme {
+		p.next()
+		node, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return node, nil
+	}
+	for _, node := range nodes {
+		if _, ok := node.(*Not); ok {
+			return nil, &QueryError{Pos: start.pos, Msg: "NOT can't be used with OR"}
+		}
+	}
+	return &Or{Nodes: nodes}, nil
+}
+
+func (p *parser) and() (Node, error) {
+	node, err := p.near()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Node{node}
+	for p.peek().kind == andLexeme {
+		p.next()
+		node, err := p.near()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return node, nil
+	}
+	return &And{Nodes: nodes}, nil
+}
+
+func (p *parser) near() (Node, error) {
+	node, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	var near *Near
+	for l := p.peek(); l.kind == nearLexeme || l.kind == aroundLexeme; l = p.peek() {
+		p.next()
+		if near == nil {
+			near = &Near{Nodes: []Node{node}, Distance: l.distance, Ordered: l.kind == nearLexeme}
+		} else if near.Distance != l.distance || near.Ordered != (l.kind == nearLexeme) {
+			return nil, &QueryError{Pos: l.pos, Msg: fmt.Sprintf("%s can't be used after %s", l.text, near.operator())}
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		for _, operand := range []Node{node, right} {
+			switch operand.(type) {
+			case *Term, *Phrase:
+			default:
+				return nil, &QueryError{Pos: l.pos, Msg: l.text + " can be used only between keywords and phrases"}
+			}
+		}
+		near.Nodes = append(near.Nodes, right)
+		node = right
+	}
+	if near == nil {
+		return node, nil
+	}
+	return near, nil
+}
+
+func (p *parser) unary() (Node, error) {
+	switch p.peek().kind {
+	case notLexeme, minusLexeme:
+		p.next()
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Node: node}, nil
+	case plusLexeme:
+		p.next()
+		node, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &Required{Node: node}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	l := p.next()
+	switch l.kind {
+	case wordLexeme:
+		if l.distance > 0 && isWildcard(l.text) {
+			return nil, &QueryError{Pos: l.pos, Msg: "fuzzy term can't contain wildcards"}
+		}
+		return &Term{Text: l.text, Pos: l.pos, Fuzzy: l.distance}, nil
+	case phraseLexeme:
+		return &Phrase{Text: l.text}, nil
+	case openLexeme:
+		node, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		if end := p.next(); end.kind != closeLexeme {
+			return nil, &QueryError{Pos: end.pos, Msg: "closing parenthesis is expected"}
+		}
+		return node, nil
+	case closeLexeme:
+		return nil, &QueryError{Pos: l.pos, Msg: "unexpected closing parenthesis"}
+	case endLexeme:
+		return nil, &QueryError{Pos: l.pos, Msg: "keyword is expected at the end of query"}
+	}
+	return nil, &QueryError{Pos: l.pos, Msg: fmt.Sprintf("keyword is expected before %s", l.text)}
+}
+
+// query is analyzed search phrase, keyword is the first variant of word.
+// Keywords are words of not excluded terms and phrases, fuzzy are variants of every keyword found
+// by edit distance. Terms are keywords of every Term and Phrase of root
+type query struct {
+	keywords  []string
+	variants  [][]string
+	fuzzy     []map[string]bool
+	positions []int
+	root      Node
+	terms     map[Node][]Keyword
+}
+
+// analyzeQuery parses search phrase and converts its terms to keywords, positions of keywords
+// are counted through all terms of search phrase. Wildcard terms are expanded to words of src,
+// error is returned if more than limit words match, limit 0 means no limit.
+// Terms without fuzzy distance are expanded with autoFuzzy distance if it isn't 0
+func analyzeQuery(analyzer Analyzer, src source, searchPhrase string, limit, autoFuzzy int) (query, error) {
+	root, err := ParseQuery(searchPhrase)
+	if err != nil {
+		return query{}, err
+	}
+	b := queryBuilder{
+		query: query{
+			root:  root,
+			terms: map[Node][]Keyword{},
+		},
+		analyzer:  analyzer,
+		src:       src,
+		limit:     limit,
+		autoFuzzy: autoFuzzy,
+	}
+	if err := b.analyzeNode(root, false); err != nil {
+		return query{}, err
+	}
+
+	if len(b.keywords) == 0 {
+		if b.excluded {
+			return query{}, ErrOnlyExcluded
+		}
+		return query{}, ErrNoKeywords
+	}
+	return b.query, nil
+}
+
+// queryBuilder converts terms of query to keywords, position is position of the next term
+// and excluded is set if excluded terms have keywords
+type queryBuilder struct {
+	query
+	analyzer  Analyzer
+	src       source
+	limit     int
+	autoFuzzy int
+	position  int
+	excluded  bool
+}
+
+func (b *queryBuilder) analyzeNode(node Node, negated bool) error {
+	var nodes []Node
+	switch n := node.(type) {
+	case *Term:
+		if isWildcard(n.Text) {
+			return b.expandTerm(n, negated)
+		}
+		return b.analyzeText(n, n.Text, n.Fuzzy, negated)
+	case *Phrase:
+		return b.analyzeText(n, n.Text, 0, negated)
+	case *Not:
+		return b.analyzeNode(n.Node, !negated)
+	case *Required:
+		return b.analyzeNode(n.Node, negated)
+	case *Near:
+		nodes = n.Nodes
+	case *And:
+		nodes = n.Nodes
+	case *Or:
+		nodes = n.Nodes
+	case *Group:
+		nodes = n.Nodes
+	}
+	for _, node := range nodes {
+		if err := b.analyzeNode(node, negated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// analyzeText converts text of Term or Phrase to keywords, words within fuzzy edit distance
+// from keywords are added to their variants
+func (b *queryBuilder) analyzeText(node Node, text string, fuzzy int, negated bool) error {
+	keywords, err := b.analyzer.AnalyzeQuery(text)
+	if err != nil {
+		return err
+	}
+	next := b.position + 1
+	fuzzyVariants := make([]map[string]bool, len(keywords))
+	for i := range keywords {
+		keywords[i].Position += b.position
+		next = keywords[i].Position + 1
+
+		distance := fuzzy
+		if _, ok := node.(*Term); ok && distance == 0 {
+			distance = autoDistance(keywords[i].Variants[0], b.autoFuzzy)
+		}
+		if distance == 0 {
+			continue
+		}
+		fuzzyVariants[i] = map[string]bool{}
+		for _, variant := range keywords[i].Variants {
+			words, err := b.src.fuzzy(variant, distance, b.limit)
+			if err != nil {
+				return err
+			}
+			for _, word := range words {
+				if !contains(keywords[i].Variants, word) {
+					fuzzyVariants[i][word] = true
+					keywords[i].Variants = append(keywords[i].Variants, word)
+				}
+			}
+		}
+	}
+	b.position = next
+	b.addKeywords(node, keywords, fuzzyVariants, negated)
+	return nil
+}
+
+// autoDistance returns edit distance for automatic fuzzy search of word, it's less than max
+// for short words: words shorter than 3 letters are searched exactly, shorter than 6 letters with distance 1
+func autoDistance(word string, max int) int {
+	length := utf8.RuneCountInString(word)
+	switch {
+	case length < 3:
+		return 0
+	case length < 6 && max > 1:
+		return 1
+	}
+	return max
+}
+
+// expandTerm converts wildcard term to keyword with all matching words as variants. Pattern is matched
+// with indexed words and with their surface forms, so prefixes of words written in files find their stems.
+// Term without matching words keeps its pattern as the only variant, so it matches nothing
+func (b *queryBuilder) expandTerm(term *Term, negated bool) error {
+	pattern := strings.ToLower(term.Text)
+	limit := b.limit
+	if limit > 0 {
+		limit++
+	}
+	tooMany := &QueryError{Pos: term.Pos, Msg: fmt.Sprintf("%s matches more than %d words", term.Text, b.limit)}
+	words, err := b.src.expand(pattern, limit)
+	if err != nil {
+		return err
+	}
+	if b.src.expandForms != nil {
+		forms, err := b.src.expandForms(pattern, limit)
+		if err != nil {
+			return err
+		}
+		if b.limit > 0 && len(forms) > b.limit {
+			return tooMany
+		}
+		for _, form := range forms {
+			if !contains(words, form.Word) {
+				words = append(words, form.Word)
+			}
+		}
+	}
+	if b.limit > 0 && len(words) > b.limit {
+		return tooMany
+	}
+	if len(words) == 0 {
+		words = []string{pattern}
+	}
+	keywords := []Keyword{{Variants: words, Position: b.position}}
+	b.position++
+	b.addKeywords(term, keywords, make([]map[string]bool, 1), negated)
+	return nil
+}
+
+// addKeywords saves keywords of Term or Phrase with their fuzzy variants, keywords of not excluded
+// nodes are keywords of query
+func (b *queryBuilder) addKeywords(node Node, keywords []Keyword, fuzzy []map[string]bool, negated bool) {
+	b.terms[node] = keywords
+	for i, keyword := range keywords {
+		if negated {
+			b.excluded = true
+			continue
+		}
+		b.keywords = append(b.keywords, keyword.Variants[0])
+		b.variants = append(b.variants, keyword.Variants)
+		b.fuzzy = append(b.fuzzy, fuzzy[i])
+		b.positions = append(b.positions, keyword.Position)
+	}
+}
+
+// postings finds files with words, every word is looked up once.
+// Closeness of file is 1 divided by the average distance between nodes of the closest Near of query
+type postings struct {
+	lookup    func(word string) ([]WordIndex, error)
+	words     map[string][]WordIndex
+	closeness map[string]float64
+}
+
+func newPostings(lookup func(word string) ([]WordIndex, error)) *postings {
+	return &postings{
+		lookup:    lookup,
+		words:     map[string][]WordIndex{},
+		closeness: map[string]float64{},
+	}
+}
+
+// keyword returns files and positions of all variants of keyword
+func (p *postings) keyword(variants []string) ([]WordIndex, error) {
+	var keywordIndex []WordIndex
+	for _, variant := range variants {
+		variantIndex, ok := p.words[variant]
+		if !ok {
+			var err error
+			variantIndex, err = p.lookup(variant)
+			if err != nil {
+				return nil, err
+			}
+			p.words[variant] = variantIndex
+		}
+		keywordIndex = append(keywordIndex, variantIndex...)
+	}
+	return keywordIndex, nil
+}
+
+// match returns files matching node, false is returned if node has no keywords
+func (p *postings) match(q query, node Node) (map[string]bool, bool, error) {
+	switch n := node.(type) {
+	case *Term:
+		return p.matchTerm(q.terms[n])
+	case *Phrase:
+		return p.matchPhrase(q.terms[n])
+	case *Near:
+		return p.matchNear(q, n)
+	case *Required:
+		return p.match(q, n.Node)
+	case *Not:
+		return nil, false, ErrOnlyExcluded
+	case *Or:
+		var files map[string]bool
+		for _, node := range n.Nodes {
+			nodeFiles, ok, err := p.match(q, node)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				files = union(files, nodeFiles)
+			}
+		}
+		return files, files != nil, nil
+	case *And:
+		return p.matchAll(q, n.Nodes, nil)
+	case *Group:
+		var required, optional []Node
+		for _, node := range n.Nodes {
+			if r, ok := node.(*Required); ok {
+				required = append(required, r.Node)
+			} else {
+				optional = append(optional, node)
+			}
+		}
+		if len(required) == 0 {
+			return p.matchAll(q, nil, optional)
+		}
+		var excluded []Node
+		for _, node := range optional {
+			if _, ok := node.(*Not); ok {
+				excluded = append(excluded, node)
+			}
+		}
+		return p.matchAll(q, append(required, excluded...), nil)
+	}
+	return nil, false, nil
+}
+
+// matchAll returns files matching all nodes and any of optional nodes, Not nodes exclude files
+func (p *postings) matchAll(q query, nodes, optional []Node) (map[string]bool, bool, error) {
+	var files, excluded map[string]bool
+	all, any, hasExcluded := false, false, false
+	var anyFiles map[string]bool
+	add := func(node Node, required bool) error {
+		if not, ok := node.(*Not); ok {
+			notFiles, ok, err := p.match(q, not.Node)
+			if err != nil {
+				return err
+			}
+			if ok {
+				hasExcluded = true
+				excluded = union(excluded, notFiles)
+			}
+			return nil
+		}
+		nodeFiles, ok, err := p.match(q, node)
+		if err != nil || !ok {
+			return err
+		}
+		if required {
+			if !all {
+				files, all = nodeFiles, true
+			} else {
+				files = intersect(files, nodeFiles)
+			}
+		} else {
+			anyFiles, any = union(anyFiles, nodeFiles), true
+		}
+		return nil
+	}
+	for _, node := range nodes {
+		if err := add(node, true); err != nil {
+			return nil, false, err
+		}
+	}
+	for _, node := range optional {
+		if err := add(node, false); err != nil {
+			return nil, false, err
+		}
+	}
+
+	switch {
+	case all:
+	case any:
+		files = anyFiles
+	case hasExcluded:
+		return nil, false, ErrOnlyExcluded
+	default:
+		return nil, false, nil
+	}
+	result := map[string]bool{}
+	for file := range files {
+		if !excluded[file] {
+			result[file] = true
+		}
+	}
+	return result, true, nil
+}
+
+// matchTerm returns files with all keywords of term
+func (p *postings) matchTerm(keywords []Keyword) (map[string]bool, bool, error) {
+	if len(keywords) == 0 {
+		return nil, false, nil
+	}
+	var files map[string]bool
+	for i, keyword := range keywords {
+		keywordIndex, err := p.keyword(keyword.Variants)
+		if err != nil {
+			return nil, false, err
+		}
+		keywordFiles := map[string]bool{}
+		for _, indexFile := range keywordIndex {
+			keywordFiles[indexFile.File] = true
+		}
+		if i == 0 {
+			files = keywordFiles
+		} else {
+			files = intersect(files, keywordFiles)
+		}
+	}
+	return files, true, nil
+}
+
+// matchPhrase returns files with keywords of phrase at the same distances as in phrase
+func (p *postings) matchPhrase(keywords []Keyword) (map[string]bool, bool, error) {
+	if len(keywords) == 0 {
+		return nil, false, nil
+	}
+	starts, err := p.phraseStarts(keywords)
+	if err != nil {
+		return nil, false, err
+	}
+	files := map[string]bool{}
+	for file := range starts {
+		files[file] = true
+	}
+	return files, true, nil
+}
+
+// phraseStarts returns positions of the first keyword of phrase in files
+func (p *postings) phraseStarts(keywords []Keyword) (map[string]map[int]bool, error) {
+	var starts map[string]map[int]bool
+	for i, keyword := range keywords {
+		keywordIndex, err := p.keyword(keyword.Variants)
+		if err != nil {
+			return nil, err
+		}
+		offset := keyword.Position - keywords[0].Position
+		next := map[string]map[int]bool{}
+		for _, indexFile := range keywordIndex {
+			for _, position := range indexFile.Positions {
+				start := position - offset
+				if i > 0 && !starts[indexFile.File][start] {
+					continue
+				}
+				if next[indexFile.File] == nil {
+					next[indexFile.File] = map[int]bool{}
+				}
+				next[indexFile.File][start] = true
+			}
+		}
+		starts = next
+	}
+	return starts, nil
+}
+
+// occurrence is place of Term or Phrase in file from the first to the last keyword
+type occurrence struct {
+	start, end int
+}
+
+// matchNear returns files with nodes of near within its distance and saves closeness of the files.
+// Nodes without keywords are skipped
+func (p *postings) matchNear(q query, near *Near) (map[string]bool, bool, error) {
+	var nodes []map[string][]occurrence
+	for _, node := range near.Nodes {
+		keywords := q.terms[node]
+		if len(keywords) == 0 {
+			continue
+		}
+		starts, err := p.phraseStarts(keywords)
+		if err != nil {
+			return nil, false, err
+		}
+		length := keywords[len(keywords)-1].Position - keywords[0].Position
+		occurrences := map[string][]occurrence{}
+		for file, positions := range starts {
+			for start := range positions {
+				occurrences[file] = append(occurrences[file], occurrence{start: start, end: start + length})
+			}
+			sorted := occurrences[file]
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+		}
+		nodes = append(nodes, occurrences)
+	}
+	if len(nodes) == 0 {
+		return nil, false, nil
+	}
+
+	files := map[string]bool{}
+	for file := range nodes[0] {
+		chain := make([]chained, len(nodes[0][file]))
+		for i, o := range nodes[0][file] {
+			chain[i] = chained{occurrence: o}
+		}
+		for _, node := range nodes[1:] {
+			if chain = near.next(chain, node[file]); len(chain) == 0 {
+				break
+			}
+		}
+		if len(chain) == 0 {
+			continue
+		}
+		files[file] = true
+		if len(nodes) > 1 {
+			best := math.MaxInt32
+			for _, c := range chain {
+				if c.sum < best {
+					best = c.sum
+				}
+			}
+			closeness := float64(len(nodes)-1) / float64(best)
+			if closeness > p.closeness[file] {
+				p.closeness[file] = closeness
+			}
+		}
+	}
+	return files, true, nil
+}
+
+// chained is occurrence of node with the least sum of distances to occurrences of the previous nodes
+type chained struct {
+	occurrence
+	sum int
+}
+
+// next returns occurrences of the next node within Distance from chain with the least sums of distances.
+// Chain and occurrences are sorted by start, occurrences of one node have the same length, so they are
+// sorted by end too. The least sums of chain before and after occurrence are kept in sliding windows
+// with increasing sums, so lists are merged in linear time
+func (near *Near) next(chain []chained, occurrences []occurrence) []chained {
+	var next, before, after []chained
+	i, j := 0, 0
+	for _, o := range occurrences {
+		// chain before o: o.start-Distance <= end < o.start, sum is c.sum+o.start-c.end
+		for ; i < len(chain) && chain[i].end < o.start; i++ {
+			for len(before) > 0 && before[len(before)-1].sum-before[len(before)-1].end >= chain[i].sum-chain[i].end {
+				before = before[:len(before)-1]
+			}
+			before = append(before, chain[i])
+		}
+		for len(before) > 0 && o.start-before[0].end > near.Distance {
+			before = before[1:]
+		}
+		best, found := 0, false
+		if len(before) > 0 {
+			best, found = before[0].sum+o.start-before[0].end, true
+		}
+		if !near.Ordered {
+			// chain after o: o.end < start <= o.end+Distance, sum is c.sum+c.start-o.end
+			for ; j < len(chain) && chain[j].start-o.end <= near.Distance; j++ {
+				for len(after) > 0 && after[len(after)-1].sum+after[len(after)-1].start >= chain[j].sum+chain[j].start {
+					after = after[:len(after)-1]
+				}
+				after = append(after, chain[j])
+			}
+			for len(after) > 0 && after[0].start <= o.end {
+				after = after[1:]
+			}
+			if len(after) > 0 {
+				if sum := after[0].sum + after[0].start - o.end; !found || sum < best {
+					best, found = sum, true
+				}
+			}
+		}
+		if found {
+			next = append(next, chained{occurrence: o, sum: best})
+		}
+	}
+	return next
+}
+
+func union(a, b map[string]bool) map[string]bool {
+	if a == nil {
+		a = map[string]bool{}
+	}
+	for file := range b {
+		a[file] = true
+	}
+	return a
+}
+
+func intersect(a, b map[string]bool) map[string]bool {
+	result := map[string]bool{}
+	for file := range a {
+		if b[file] {
+			result[file] = true
+		}
+	}
+	return result
+}
+
+// isDigits reports if text contains only ASCII digits
+func isDigits(text string) bool {
+	for _, r := range text {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package index
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	cases := map[string]string{
+		"tea":                                    "tea",
+		"cup of tea":                             "(cup of tea)",
+		"tea AND milk OR coffee":                 "((tea AND milk) OR coffee)",
+		"tea AND (milk OR sugar)":                "(tea AND (milk OR sugar))",
+		"+tea milk -sugar":                       "(+tea milk -sugar)",
+		"tea NOT sugar":                          "(tea -sugar)",
+		"tea and or not":                         "(tea and or not)",
+		"e-mail - tea":                           "(e-mail - tea)",
+		`"cup of tea" -"black tea"`:              `("cup of tea" -"black tea")`,
+		"tea NEAR/3 cup AND milk":                "((tea NEAR/3 cup) AND milk)",
+		`tea AROUND/2 "black cup" AROUND/2 milk`: `(tea AROUND/2 "black cup" AROUND/2 milk)`,
+		"serach~1 tea~ a~b":                      "(serach~1 tea~2 a~b)",
+		"NEAR tea":                               "(NEAR tea)",
+		`tea"cup"`:                               `(tea "cup")`,
+	}
+	for text, expect := range cases {
+		node, err := ParseQuery(text)
+		if err != nil {
+			t.Errorf("%q: %v", text, err)
+			continue
+		}
+		if actual := node.String(); actual != expect {
+			t.Errorf("%q: %v isn't equal to expected %v", text, actual, expect)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	cases := map[string]QueryError{
+		"":                    QueryError{0, "keywords are expected"},
+		"tea AND":             QueryError{7, "keyword is expected at the end of query"},
+		"tea OR OR milk":      QueryError{7, "keyword is expected before OR"},
+		"(tea milk":           QueryError{9, "closing parenthesis is expected"},
+		"tea) milk":           QueryError{3, "unexpected closing parenthesis"},
+		"tea OR NOT milk":     QueryError{0, "NOT can't be used with OR"},
+		"()":                  QueryError{1, "keywords are expected"},
+		`"cup of tea`:         QueryError{11, "closing quote is expected"},
+		"tea NEAR/0 cup":      QueryError{9, "positive distance is expected after NEAR/"},
+		"tea NEAR/2 -cup":     QueryError{4, "NEAR/2 can be used only between keywords and phrases"},
+		"a NEAR/2 b NEAR/3 c": QueryError{11, "NEAR/3 can't be used after NEAR/2"},
+		"tea~3":               QueryError{4, "edit distance 1 or 2 is expected after ~"},
+		"te*~1":               QueryError{0, "fuzzy term can't contain wildcards"},
+	}
+	for text, expect := range cases {
+		_, err := ParseQuery(text)
+		actual, ok := err.(*QueryError)
+		if !ok {
+			t.Errorf("%q: %v isn't query error", text, err)
+			continue
+		}
+		if *actual != expect {
+			t.Errorf("%q: %v isn't equal to expected %v", text, *actual, expect)
+		}
+	}
+}
+
+func TestSearchingBoolean(t *testing.T) {
+	index := ReverseIndex{}
+	index.addFileInIndex("1.txt", analyze(t, "cup of tea with milk"))
+	index.addFileInIndex("2.txt", analyze(t, "black tea with sugar"))
+	index.addFileInIndex("3.txt", analyze(t, "black coffee with milk"))
+
+	cases := map[string][]string{
+		"tea milk":                  []string{"1.txt", "2.txt", "3.txt"},
+		"tea AND milk":              []string{"1.txt"},
+		"tea -sugar":                []string{"1.txt"},
+		"milk NOT tea":              []string{"3.txt"},
+		"+black tea":                []string{"2.txt", "3.txt"},
+		"(tea OR coffee) AND black": []string{"2.txt", "3.txt"},
+		"tea AND milk OR coffee":    []string{"1.txt", "3.txt"},
+		"black -(sugar OR milk)":    []string{},
+		"tea AND the":               []string{"1.txt", "2.txt"},
+	}
+	for text, expect := range cases {
+		actual, err := index.Searching(text)
+		if err != nil {
+			t.Errorf("%q: %v", text, err)
+			continue
+		}
+		sort.Strings(actual)
+		if len(actual) == 0 {
+			actual = []string{}
+		}
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%q: %v isn't equal to expected %v", text, actual, expect)
+		}
+	}
+
+	if _, err := index.Searching(`-"black tea"`); err != ErrOnlyExcluded {
+		t.Errorf("%v isn't equal to expected %v", err, ErrOnlyExcluded)
+	}
+	if _, err := index.Searching("tea AND"); err == nil {
+		t.Error("error of query isn't returned")
+	}
+}
+
+func TestSearchingPhrase(t *testing.T) {
+	index := ReverseIndex{}
+	index.addFileInIndex("1.txt", analyze(t, "cup of black tea"))
+	index.addFileInIndex("2.txt", analyze(t, "black cup of tea"))
+	index.addFileInIndex("3.txt", analyze(t, "tea cup and black coffee"))
+
+	cases := map[string][]string{
+		`"black tea"`:              []string{"1.txt"},
+		`"cup of tea"`:             []string{"2.txt"},
+		`"cup and tea"`:            []string{"2.txt"},
+		`"tea cup"`:                []string{"3.txt"},
+		`cup -"black tea"`:         []string{"2.txt", "3.txt"},
+		`"black cup" OR "tea cup"`: []string{"2.txt", "3.txt"},
+		`"black coffee" AND tea`:   []string{"3.txt"},
+	}
+	for text, expect := range cases {
+		actual, err := index.Searching(text)
+		if err != nil {
+			t.Errorf("%q: %v", text, err)
+			continue
+		}
+		sort.Strings(actual)
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%q: %v isn't equal to expected %v", text, actual, expect)
+		}
+	}
+}
+
+func TestNearNext(t *testing.T) {
+	// nextSlow compares every occurrence with every occurrence of chain
+	nextSlow := func(near *Near, chain []chained, occurrences []occurrence) []chained {
+		var next []chained
+		for _, o := range occurrences {
+			best, found := 0, false
+			for _, c := range chain {
+				d := o.start - c.end
+				if !near.Ordered && o.end < c.start {
+					d = c.start - o.end
+				}
+				if d > 0 && d <= near.Distance && (!found || c.sum+d < best) {
+					best, found = c.sum+d, true
+				}
+			}
+			if found {
+				next = append(next, chained{occurrence: o, sum: best})
+			}
+		}
+		return next
+	}
+	random := rand.New(rand.NewSource(1))
+	occurrences := func(length int) []occurrence {
+		var list []occurrence
+		for start := 0; start < 100; start += 1 + random.Intn(8) {
+			list = append(list, occurrence{start: start, end: start + length})
+		}
+		return list
+	}
+	for i := 0; i < 200; i++ {
+		near := &Near{Distance: 1 + random.Intn(10), Ordered: i%2 == 0}
+		var chain []chained
+		for _, o := range occurrences(random.Intn(3)) {
+			chain = append(chain, chained{occurrence: o, sum: random.Intn(20)})
+		}
+		next := occurrences(random.Intn(3))
+		if actual, expect := near.next(chain, next), nextSlow(near, chain, next); !reflect.DeepEqual(actual, expect) {
+			t.Fatalf("%+v:\n%v isn't equal to expected\n%v", near, actual, expect)
+		}
+	}
+}
+
+func TestSearchingNear(t *testing.T) {
+	index := ReverseIndex{}
+	index.addFileInIndex("1.txt", analyze(t, "tea with a cup of milk"))
+	index.addFileInIndex("2.txt", analyze(t, "cup of tea"))
+	index.addFileInIndex("3.txt", analyze(t, "tea cup"))
+
+	cases := map[string][]string{
+		"tea NEAR/1 cup":               []string{"3.txt"},
+		"tea NEAR/3 cup":               []string{"3.txt", "1.txt"},
+		"tea AROUND/2 cup":             []string{"3.txt", "2.txt"},
+		"tea AROUND/5 cup":             []string{"3.txt", "2.txt", "1.txt"},
+		"cup NEAR/2 milk":              []string{"1.txt"},
+		"tea NEAR/3 cup NEAR/3 milk":   []string{"1.txt"},
+		`"a cup of milk" AROUND/3 tea`: []string{"1.txt"},
+	}
+	for text, expect := range cases {
+		for _, ranker := range []string{PhraseRanker, BM25Ranker} {
+			r, err := RankerByName(ranker)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := searching(source{lookup: index.lookup}, englishAnalyzer, text, SearchOptions{Ranker: r}, newCollection(nil))
+			if err != nil {
+				t.Errorf("%q: %v", text, err)
+				continue
+			}
+			if !reflect.DeepEqual(actual, expect) {
+				t.Errorf("%q, %s: %v isn't equal to expected %v", text, ranker, actual, expect)
+			}
+		}
+	}
+}
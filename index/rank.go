@@ -0,0 +1,418 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Names of builtin ranking policies
+const (
+	PhraseRanker    = "phrase"
+	TFIDFRanker     = "tf-idf"
+	BM25Ranker      = "bm25"
+	ProximityRanker = "proximity"
+)
+
+// Hit is keyword of search phrase found in file at position
+type Hit struct {
+	Keyword  string
+	Position int
+}
+
+// Match is found file with hits of keywords sorted by position, Score is set by Ranker.
+// Closeness is 1 divided by the average distance between words joined by NEAR or AROUND in the file,
+// it's 0 for search phrases without them. Fuzzy is set if some keyword is found only by fuzzy variants,
+// such files are placed after others after ranking
+type Match struct {
+	File      string
+	Hits      []Hit
+	Score     float64
+	Closeness float64
+	Fuzzy     bool
+}
+
+// Stats is data for ranking of found files. Keywords are keywords of search phrase with their Positions
+// in the phrase, DocFreq is count of files with every keyword. Files is count of indexed files,
+// Length returns count of tokens of file and AvgLength is average count of tokens
+type Stats struct {
+	Keywords  []string
+	Positions []int
+	DocFreq   map[string]int
+	Files     int
+	AvgLength float64
+	Length    func(file string) int
+}
+
+// Ranker sets scores of matches and sorts them from the most relevant
+type Ranker interface {
+	Name() string
+	Rank(matches []Match, stats Stats)
+}
+
+// SearchOptions sets ranking of search results, nil Ranker means PhraseRanker.
+// MaxExpansions is max count of words matching wildcard or fuzzy term, 0 means DefaultMaxExpansions.
+// If AutoFuzzy is 1 or 2 and nothing is found, words of query are searched with this edit distance
+type SearchOptions struct {
+	Ranker        Ranker
+	MaxExpansions int
+	AutoFuzzy     int
+}
+
+func (opts SearchOptions) maxExpansions() int {
+	if opts.MaxExpansions <= 0 {
+		return DefaultMaxExpansions
+	}
+	return opts.MaxExpansions
+}
+
+func (opts SearchOptions) ranker() Ranker {
+	if opts.Ranker == nil {
+		return phrase{}
+	}
+	return opts.Ranker
+}
+
+var (
+	rankersMu sync.RWMutex
+	rankers   = map[string]Ranker{}
+)
+
+func init() {
+	RegisterRanker(phrase{})
+	RegisterRanker(tfidf{})
+	RegisterRanker(DefaultBM25)
+	RegisterRanker(proximity{})
+}
+
+// RegisterRanker makes ranker available by its name, ranker with the same name is replaced
+func RegisterRanker(ranker Ranker) {
+	rankersMu.Lock()
+	defer rankersMu.Unlock()
+	rankers[ranker.Name()] = ranker
+}
+
+// RankerByName returns registered ranker, empty name means PhraseRanker
+func RankerByName(name string) (Ranker, error) {
+	if name == "" {
+		name = PhraseRanker
+	}
+	rankersMu.RLock()
+	defer rankersMu.RUnlock()
+	ranker, ok := rankers[name]
+	if !ok {
+		names := make([]string, 0, len(rankers))
+		for name := range rankers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("Ranker %q isn't found, known rankers: %v", name, names)
+	}
+	return ranker, nil
+}
+
+// collection is statistics of indexed files used for ranking, length returns count of tokens of file
+type collection struct {
+	files     int
+	avgLength float64
+	length    func(file string) int
+}
+
+// newCollection returns statistics of files by their lengths
+func newCollection(lengths map[string]int) collection {
+	docs := collection{
+		files:  len(lengths),
+		length: func(file string) int { return lengths[file] },
+	}
+	total := 0
+	for _, length := range lengths {
+		total += length
+	}
+	if len(lengths) != 0 {
+		docs.avgLength = float64(total) / float64(len(lengths))
+	}
+	return docs
+}
+
+// collection returns statistics of files in manifest
+func (manifest Manifest) collection() collection {
+	lengths := make(map[string]int, len(manifest))
+	for name, doc := range manifest {
+		lengths[name] = doc.Length
+	}
+	return newCollection(lengths)
+}
+
+// rankResults returns found files sorted by ranker of opts, df is count of files with every keyword
+func rankResults(results map[string]searchResult, q query, df map[string]int, closeness map[string]float64,
+	docs collection, opts SearchOptions) []SearchResult {
+	matches := make([]Match, 0, len(results))
+	spans := make(map[string]map[int]Span, len(results))
+	for file, result := range results {
+		match := Match{
+			File:      file,
+			Hits:      make([]Hit, len(result.words)),
+			Closeness: closeness[file],
+			Fuzzy:     result.fuzzy,
+		}
+		for i, word := range result.words {
+			match.Hits[i] = Hit{Keyword: word.word, Position: word.position}
+			// line is counted from 1, so spans of old indexes have zero line
+			if word.span.Line != 0 {
+				if spans[file] == nil {
+					spans[file] = map[int]Span{}
+				}
+				spans[file][word.position] = word.span
+			}
+		}
+		sort.SliceStable(match.Hits, func(i, j int) bool { return match.Hits[i].Position < match.Hits[j].Position })
+		matches = append(matches, match)
+	}
+
+	// files can't be less than found files, it matters for index without statistics of files
+	files := int(math.Max(float64(docs.files), float64(len(results))))
+	for _, freq := range df {
+		files = int(math.Max(float64(files), float64(freq)))
+	}
+	opts.ranker().Rank(matches, Stats{
+		Keywords:  q.keywords,
+		Positions: q.positions,
+		DocFreq:   df,
+		Files:     files,
+		AvgLength: docs.avgLength,
+		Length:    docs.length,
+	})
+	sort.SliceStable(matches, func(i, j int) bool { return !matches[i].Fuzzy && matches[j].Fuzzy })
+
+	searchResults := make([]SearchResult, len(matches))
+	for i, match := range matches {
+		searchResults[i] = newSearchResult(match, q, spans[match.File])
+	}
+	return searchResults
+}
+
+// SearchResult is found file with data of ranking. Count is count of found keywords in file,
+// UniqueKeywords is count of different found keywords, LongestPhrase is count of words
+// of the longest part of search phrase in file and Hits are matched positions of keywords
+// sorted by position. Spans are places of Hits in file text, they are empty if index has no spans
+// and span of hit without place has zero Line. Score, Closeness and Fuzzy are the same as in Match
+type SearchResult struct {
+	File           string
+	Score          float64
+	Count          int
+	UniqueKeywords int
+	LongestPhrase  int
+	Hits           []Hit
+	Spans          []Span
+	Closeness      float64
+	Fuzzy          bool
+}
+
+// newSearchResult returns result of ranked match of query, spans are places of hits by their positions
+func newSearchResult(match Match, q query, spans map[int]Span) SearchResult {
+	result := SearchResult{
+		File:           match.File,
+		Score:          match.Score,
+		Count:          len(match.Hits),
+		UniqueKeywords: len(match.counts()),
+		Hits:           match.Hits,
+		Closeness:      match.Closeness,
+		Fuzzy:          match.Fuzzy,
+	}
+	if len(match.Hits) != 0 {
+		words := make([]wordOnFile, len(match.Hits))
+		for i, hit := range match.Hits {
+			words[i] = wordOnFile{word: hit.Keyword, position: hit.Position}
+		}
+		result.LongestPhrase = maxLengthSearchPhrase(words, q.keywords, q.positions)
+	}
+	if len(spans) != 0 {
+		result.Spans = make([]Span, len(match.Hits))
+		for i, hit := range match.Hits {
+			result.Spans[i] = spans[hit.Position]
+		}
+	}
+	return result
+}
+
+// Results is found files sorted from the most relevant, Keywords are analyzed words of search phrase
+type Results struct {
+	Keywords []string
+	Matches  []SearchResult
+}
+
+// Files returns names of found files
+func (results Results) Files() []string {
+	files := make([]string, len(results.Matches))
+	for i, match := range results.Matches {
+		files[i] = match.File
+	}
+	return files
+}
+
+// boostCloseness multiplies scores of matches by their closeness increased by 1
+func boostCloseness(matches []Match) {
+	for i := range matches {
+		matches[i].Score *= 1 + matches[i].Closeness
+	}
+}
+
+// sortByScore sorts matches by score, matches with equal score are sorted by file name
+func sortByScore(matches []Match) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].File < matches[j].File
+	})
+}
+
+// counts returns count of hits of every keyword
+func (match Match) counts() map[string]int {
+	counts := map[string]int{}
+	for _, hit := range match.Hits {
+		counts[hit.Keyword]++
+	}
+	return counts
+}
+
+// idf returns inverse document frequency of keyword
+func (stats Stats) idf(keyword string) float64 {
+	freq := float64(stats.DocFreq[keyword])
+	return math.Log(1 + (float64(stats.Files)-freq+0.5)/(freq+0.5))
+}
+
+// phrase sorts files by the longest part of search phrase, then by closeness, then by count
+// of unique keywords and then by count of keywords. Score is length of the longest part of search phrase
+type phrase struct{}
+
+func (phrase) Name() string {
+	return PhraseRanker
+}
+
+func (phrase) Rank(matches []Match, stats Stats) {
+	results := make(map[string]searchResult, len(matches))
+	for _, match := range matches {
+		result := searchResult{count: len(match.Hits)}
+		for _, hit := range match.Hits {
+			result.words = append(result.words, wordOnFile{word: hit.Keyword, position: hit.Position})
+		}
+		results[match.File] = result
+	}
+
+	counterUniqueKeywords(results, stats.Keywords)
+	sortPositions(results)
+	for file, result := range results {
+		result.maxLengthPhrase = maxLengthSearchPhrase(result.words, stats.Keywords, stats.Positions)
+		results[file] = result
+	}
+	sliceResults := convertMapToSlice(results)
+	sortSearchResults(sliceResults)
+
+	byFile := make(map[string]Match, len(matches))
+	for _, match := range matches {
+		byFile[match.File] = match
+	}
+	for i, result := range sliceResults {
+		matches[i] = byFile[result.file]
+		matches[i].Score = float64(result.maxLengthPhrase)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Closeness > matches[j].Closeness
+	})
+}
+
+// tfidf scores files by sum of logarithmic counts of keywords multiplied by their rarity
+type tfidf struct{}
+
+func (tfidf) Name() string {
+	return TFIDFRanker
+}
+
+func (tfidf) Rank(matches []Match, stats Stats) {
+	for i := range matches {
+		score := 0.0
+		for keyword, count := range matches[i].counts() {
+			score += (1 + math.Log(float64(count))) * stats.idf(keyword)
+		}
+		matches[i].Score = score
+	}
+	boostCloseness(matches)
+	sortByScore(matches)
+}
+
+// BM25 is ranker scoring files by BM25. K1 limits growth of score with count of keyword in file,
+// B sets normalization by file length from 0 (none) to 1 (full)
+type BM25 struct {
+	K1 float64
+	B  float64
+}
+
+// DefaultBM25 is BM25 with commonly used parameters
+var DefaultBM25 = BM25{K1: 1.2, B: 0.75}
+
+// Name returns BM25Ranker
+func (BM25) Name() string {
+	return BM25Ranker
+}
+
+// Rank sorts matches by BM25 score
+func (params BM25) Rank(matches []Match, stats Stats) {
+	for i := range matches {
+		norm := 1.0
+		if stats.AvgLength > 0 {
+			norm = 1 - params.B + params.B*float64(stats.Length(matches[i].File))/stats.AvgLength
+		}
+		score := 0.0
+		for keyword, count := range matches[i].counts() {
+			tf := float64(count)
+			score += stats.idf(keyword) * tf * (params.K1 + 1) / (tf + params.K1*norm)
+		}
+		matches[i].Score = score
+	}
+	boostCloseness(matches)
+	sortByScore(matches)
+}
+
+// proximity scores files by count of unique keywords, files with the same count are sorted by
+// the shortest distance between words containing all found keywords
+type proximity struct{}
+
+func (proximity) Name() string {
+	return ProximityRanker
+}
+
+func (proximity) Rank(matches []Match, stats Stats) {
+	for i := range matches {
+		unique, span := minCover(matches[i].Hits)
+		matches[i].Score = float64(unique) + 1/float64(span)
+	}
+	boostCloseness(matches)
+	sortByScore(matches)
+}
+
+// minCover returns count of unique keywords of hits and length in words of the shortest part of file
+// containing all of them, hits are sorted by position
+func minCover(hits []Hit) (int, int) {
+	unique := len(Match{Hits: hits}.counts())
+	counts := map[string]int{}
+	best := math.MaxInt32
+	for start, end := 0, 0; end < len(hits); end++ {
+		counts[hits[end].Keyword]++
+		for len(counts) == unique {
+			if span := hits[end].Position - hits[start].Position + 1; span < best {
+				best = span
+			}
+			counts[hits[start].Keyword]--
+			if counts[hits[start].Keyword] == 0 {
+				delete(counts, hits[start].Keyword)
+			}
+			start++
+		}
+	}
+	return unique, best
+}
@@ -0,0 +1,128 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchingBM25(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"long.txt":  "tea cup " + strings.Repeat("black tea green tea milk ", 20),
+		"short.txt": "cup of tea",
+		"milk.txt":  "milk",
+	})
+	defer os.RemoveAll(root)
+
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if length := idx.Manifest["short.txt"].Length; length != 2 {
+		t.Errorf("length %v of file isn't equal to expected 2", length)
+	}
+
+	cases := []struct {
+		opts   SearchOptions
+		expect []string
+	}{
+		{SearchOptions{}, []string{"long.txt", "short.txt"}},
+		{SearchOptions{Ranker: DefaultBM25}, []string{"short.txt", "long.txt"}},
+		{SearchOptions{Ranker: BM25{K1: 1.2, B: 0}}, []string{"long.txt", "short.txt"}},
+	}
+	for _, c := range cases {
+		actual, err := idx.SearchingWith("tea cup", c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("%+v: %v isn't equal to expected %v", c.opts, actual, c.expect)
+		}
+	}
+}
+
+func TestSearcher(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt": "cup black tea",
+		"2.txt": "black cup tea tea",
+	})
+	defer os.RemoveAll(root)
+
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	segment := openSegment(t, idx)
+
+	searchers := map[string]Searcher{
+		"reverse index": idx.Words,
+		"index":         idx,
+		"segment":       segment,
+	}
+	expect := []SearchResult{
+		{File: "1.txt", Score: 2, Count: 2, UniqueKeywords: 2, LongestPhrase: 2,
+			Hits: []Hit{{"black", 1}, {"tea", 2}}, Spans: []Span{{4, 5, 1}, {10, 3, 1}}},
+		{File: "2.txt", Score: 1, Count: 3, UniqueKeywords: 2, LongestPhrase: 1,
+			Hits: []Hit{{"black", 0}, {"tea", 2}, {"tea", 3}}, Spans: []Span{{0, 5, 1}, {10, 3, 1}, {14, 3, 1}}},
+	}
+	for name, searcher := range searchers {
+		actual, err := searcher.Search("black tea", SearchOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual.Matches, expect) {
+			t.Errorf("%v: %+v isn't equal to expected %+v", name, actual.Matches, expect)
+		}
+	}
+}
+
+func TestRankers(t *testing.T) {
+	matches := []Match{
+		{File: "1.txt", Hits: []Hit{{"rare", 0}, {"common", 10}}},
+		{File: "2.txt", Hits: []Hit{{"common", 0}, {"common", 1}, {"common", 2}}},
+		{File: "3.txt", Hits: []Hit{{"rare", 5}, {"common", 6}}},
+		{File: "4.txt", Hits: []Hit{{"common", 5}}},
+	}
+	stats := Stats{
+		Keywords:  []string{"rare", "common"},
+		Positions: []int{0, 1},
+		DocFreq:   map[string]int{"rare": 2, "common": 4},
+		Files:     10,
+		AvgLength: 10,
+		Length:    func(file string) int { return 10 },
+	}
+	cases := map[string][]string{
+		PhraseRanker:    []string{"3.txt", "1.txt", "2.txt", "4.txt"},
+		TFIDFRanker:     []string{"1.txt", "3.txt", "2.txt", "4.txt"},
+		BM25Ranker:      []string{"1.txt", "3.txt", "2.txt", "4.txt"},
+		ProximityRanker: []string{"3.txt", "1.txt", "2.txt", "4.txt"},
+	}
+	for name, expect := range cases {
+		ranker, err := RankerByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ranked := append([]Match(nil), matches...)
+		ranker.Rank(ranked, stats)
+		var actual []string
+		for _, match := range ranked {
+			actual = append(actual, match.File)
+		}
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%v: %v isn't equal to expected %v", name, actual, expect)
+		}
+	}
+
+	if _, err := RankerByName("random"); err == nil {
+		t.Error("unknown ranker is found")
+	}
+}
+
+func TestMinCover(t *testing.T) {
+	hits := []Hit{{"a", 0}, {"b", 7}, {"a", 9}, {"c", 10}, {"b", 12}, {"c", 20}}
+	unique, span := minCover(hits)
+	if unique != 3 || span != 4 {
+		t.Errorf("%v, %v isn't equal to expected 3, 4", unique, span)
+	}
+}
@@ -0,0 +1,675 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Binary index (segment) layout, all fixed size numbers are little endian:
+//
+//	header    magic "RIDX", uint32 version
+//	postings  for every term: uvarint count of files, then for every file
+//	          uvarint delta of file id, uvarint count of positions, uvarint deltas of positions,
+//	          uvarint count of spans (0 or count of positions), then for every span:
+//	          uvarint delta of offset, uvarint length, uvarint delta of line
+//	files     uvarint length of indexed folder, indexed folder,
+//	          uvarint length of analyzer name, analyzer name, uvarint max depth of subfolders,
+//	          then for every file id:
+//	          uvarint length of name, name, uvarint size, varint modification time,
+//	          uvarint length of content hash, content hash, uvarint count of tokens
+//	terms     for every term in sorted order: uvarint length of term, term,
+//	          uvarint offset of postings, uvarint length of postings
+//	table     uint64 offset of every term in terms section, used for binary search
+//	forms     for every surface form in sorted order: uvarint length of form, form,
+//	          uvarint length of its term, term
+//	footer    uint64 count of files, uint64 count of terms, uint64 count of forms,
+//	          uint64 offsets of files, terms, table and forms sections
+//
+// File ids are numbers of files sorted by name.
+const (
+	segmentMagic   = "RIDX"
+	segmentVersion = 1
+	headerSize     = 8
+	footerSize     = 56
+)
+
+var errBadSegment = errors.New("Binary index is corrupted")
+
+// IsSegment reports if file at path is a binary index
+func IsSegment(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(segmentMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return false, nil
+		}
+		return false, err
+	}
+	return string(magic) == segmentMagic, nil
+}
+
+// ReadIndex reads index from binary or json file, the format is detected by file content
+func ReadIndex(pathToIndex string) (*Index, error) {
+	ok, err := IsSegment(pathToIndex)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return readIndexBinary(pathToIndex)
+	}
+	return readIndexJSON(pathToIndex)
+}
+
+// ReadIndexBinary - read binary 'pathToIndex' file and return ReverseIndex
+func ReadIndexBinary(pathToIndex string) (ReverseIndex, error) {
+	idx, err := readIndexBinary(pathToIndex)
+	if err != nil {
+		return nil, err
+	}
+	return idx.Words, nil
+}
+
+func readIndexBinary(pathToIndex string) (*Index, error) {
+	data, err := ioutil.ReadFile(pathToIndex)
+	if err != nil {
+		return nil, err
+	}
+	seg, err := parseSegment(data)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make(Manifest, len(seg.docs))
+	for i, doc := range seg.docs {
+		if doc.Hash != "" {
+			manifest[seg.names[i]] = doc
+		}
+	}
+
+	index := make(ReverseIndex, seg.terms)
+	for i := 0; i < seg.terms; i++ {
+		term, offset, length, err := seg.term(i)
+		if err != nil {
+			return nil, err
+		}
+		sliceIndex, err := seg.postings(offset, length)
+		if err != nil {
+			return nil, err
+		}
+		index[term] = sliceIndex
+	}
+	var forms map[string]string
+	if seg.forms != 0 {
+		forms = make(map[string]string, seg.forms)
+	}
+	err = seg.eachForm(func(form, term string) error {
+		forms[form] = term
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Index{
+		Root:     seg.root,
+		Analyzer: seg.analyzer,
+		MaxDepth: seg.maxDepth,
+		Manifest: manifest,
+		Words:    index,
+		Forms:    forms,
+	}, nil
+}
+
+// WriteIndexBinary writes index to w in the binary format
+func WriteIndexBinary(w io.Writer, index ReverseIndex) error {
+	idx := &Index{
+		Manifest: make(Manifest),
+		Words:    index,
+	}
+	return idx.WriteBinary(w)
+}
+
+// WriteBinary writes index with manifest to w in the binary format
+func (idx *Index) WriteBinary(w io.Writer) error {
+	out := &countWriter{w: bufio.NewWriter(w)}
+	index := idx.Words
+
+	files := map[string]int{}
+	for name := range idx.Manifest {
+		files[name] = 0
+	}
+	for _, sliceIndex := range index {
+		for _, item := range sliceIndex {
+			files[item.File] = 0
+		}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for id, name := range names {
+		files[name] = id
+	}
+
+	terms := make([]string, 0, len(index))
+	for term := range index {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	out.Write([]byte(segmentMagic))
+	out.uint32(segmentVersion)
+
+	type postingsRef struct{ offset, length int }
+	refs := make([]postingsRef, len(terms))
+	for i, term := range terms {
+		sliceIndex := append([]WordIndex(nil), index[term]...)
+		sort.Slice(sliceIndex, func(i, j int) bool { return files[sliceIndex[i].File] < files[sliceIndex[j].File] })
+
+		start := out.n
+		out.uvarint(uint64(len(sliceIndex)))
+		prevID := 0
+		for _, item := range sliceIndex {
+			id := files[item.File]
+			out.uvarint(uint64(id - prevID))
+			prevID = id
+			out.uvarint(uint64(len(item.Positions)))
+			prevPosition := 0
+			for _, position := range item.Positions {
+				if position < prevPosition {
+					return fmt.Errorf("Positions of word %q in file %q aren't sorted", term, item.File)
+				}
+				out.uvarint(uint64(position - prevPosition))
+				prevPosition = position
+			}
+			if len(item.Spans) != 0 && len(item.Spans) != len(item.Positions) {
+				return fmt.Errorf("Spans of word %q in file %q don't match positions", term, item.File)
+			}
+			out.uvarint(uint64(len(item.Spans)))
+			prevSpan := Span{}
+			for _, span := range item.Spans {
+				if span.Offset < prevSpan.Offset || span.Line < prevSpan.Line {
+					return fmt.Errorf("Spans of word %q in file %q aren't sorted", term, item.File)
+				}
+				out.uvarint(uint64(span.Offset - prevSpan.Offset))
+				out.uvarint(uint64(span.Length))
+				out.uvarint(uint64(span.Line - prevSpan.Line))
+				prevSpan = span
+			}
+		}
+		refs[i] = postingsRef{offset: start, length: out.n - start}
+	}
+
+	filesOffset := out.n
+	out.str(idx.Root)
+	out.str(idx.Analyzer)
+	out.uvarint(uint64(idx.MaxDepth))
+	for _, name := range names {
+		doc := idx.Manifest[name]
+		out.str(name)
+		out.uvarint(uint64(doc.Size))
+		out.varint(doc.ModTime)
+		out.str(doc.Hash)
+		out.uvarint(uint64(doc.Length))
+	}
+
+	termsOffset := out.n
+	table := make([]int, len(terms))
+	for i, term := range terms {
+		table[i] = out.n - termsOffset
+		out.str(term)
+		out.uvarint(uint64(refs[i].offset))
+		out.uvarint(uint64(refs[i].length))
+	}
+
+	tableOffset := out.n
+	for _, offset := range table {
+		out.uint64(uint64(offset))
+	}
+
+	formsOffset := out.n
+	forms := make([]string, 0, len(idx.Forms))
+	for form := range idx.Forms {
+		forms = append(forms, form)
+	}
+	sort.Strings(forms)
+	for _, form := range forms {
+		out.str(form)
+		out.str(idx.Forms[form])
+	}
+
+	for _, v := range []int{len(names), len(terms), len(forms), filesOffset, termsOffset, tableOffset, formsOffset} {
+		out.uint64(uint64(v))
+	}
+
+	if out.err != nil {
+		return out.err
+	}
+	return out.w.Flush()
+}
+
+// Segment is binary index mapped in memory. Opening doesn't decode the index,
+// terms are found by binary search and postings are decoded on every request
+type Segment struct {
+	seg       *segment
+	analyzer  Analyzer
+	docs      collection
+	unmap     func() error
+	formsOnce sync.Once
+	forms     Forms
+}
+
+// OpenSegment maps binary index file at path in memory
+func OpenSegment(path string) (*Segment, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seg, err := parseSegment(data)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	analyzer, err := AnalyzerByName(seg.analyzer)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	lengths := make(map[string]int, len(seg.names))
+	for i, name := range seg.names {
+		lengths[name] = seg.docs[i].Length
+	}
+	return &Segment{
+		seg:      seg,
+		analyzer: analyzer,
+		docs:     newCollection(lengths),
+		unmap:    unmap,
+	}, nil
+}
+
+// Analyzer returns name of analyzer used for building of segment
+func (s *Segment) Analyzer() string {
+	return s.seg.analyzer
+}
+
+// Close unmaps index file, segment can't be used after closing
+func (s *Segment) Close() error {
+	return s.unmap()
+}
+
+// Lookup returns files and positions of word, nil is returned if segment hasn't word
+func (s *Segment) Lookup(word string) ([]WordIndex, error) {
+	i, err := s.seg.find(word)
+	if err != nil || i == -1 {
+		return nil, err
+	}
+	_, offset, length, err := s.seg.term(i)
+	if err != nil {
+		return nil, err
+	}
+	return s.seg.postings(offset, length)
+}
+
+// Searching is func for search with mapped reverse index
+func (s *Segment) Searching(searchPhrase string) ([]string, error) {
+	return s.SearchingWith(searchPhrase, SearchOptions{})
+}
+
+// SearchingWith is func for search with mapped reverse index, found files are ranked by opts
+func (s *Segment) SearchingWith(searchPhrase string, opts SearchOptions) ([]string, error) {
+	return searching(s.source(), s.analyzer, searchPhrase, opts, s.docs)
+}
+
+// Search is func for search with mapped reverse index returning ranked matches
+func (s *Segment) Search(searchPhrase string, opts SearchOptions) (Results, error) {
+	return search(s.source(), s.analyzer, searchPhrase, opts, s.docs)
+}
+
+// source returns storage of segment, segments of indexes without surface forms have no forms
+func (s *Segment) source() source {
+	src := source{lookup: s.Lookup, expand: s.Expand, fuzzy: s.Fuzzy}
+	if forms := s.surfaceForms(); len(forms) != 0 {
+		src.expandForms, src.fuzzyForms = forms.Expand, forms.Fuzzy
+	}
+	return src
+}
+
+// countWriter writes encoded numbers and counts written bytes, the first error is kept in err
+type countWriter struct {
+	w   *bufio.Writer
+	n   int
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += n
+	cw.err = err
+	return n, err
+}
+
+func (cw *countWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(cw.buf[:], v)
+	cw.Write(cw.buf[:n])
+}
+
+func (cw *countWriter) varint(v int64) {
+	n := binary.PutVarint(cw.buf[:], v)
+	cw.Write(cw.buf[:n])
+}
+
+func (cw *countWriter) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(cw.buf[:4], v)
+	cw.Write(cw.buf[:4])
+}
+
+func (cw *countWriter) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(cw.buf[:8], v)
+	cw.Write(cw.buf[:8])
+}
+
+func (cw *countWriter) str(s string) {
+	cw.uvarint(uint64(len(s)))
+	cw.Write([]byte(s))
+}
+
+// segment decodes binary index from bytes
+type segment struct {
+	data        []byte
+	files       int
+	terms       int
+	filesOffset int
+	forms       int
+	termsOffset int
+	tableOffset int
+	formsOffset int
+	root        string
+	analyzer    string
+	maxDepth    int
+	names       []string
+	docs        []Document
+}
+
+func parseSegment(data []byte) (*segment, error) {
+	if len(data) < headerSize+footerSize || !bytes.Equal(data[:4], []byte(segmentMagic)) {
+		return nil, errBadSegment
+	}
+	version := binary.LittleEndian.Uint32(data[4:8])
+	if version != segmentVersion {
+		return nil, fmt.Errorf("Binary index version %v isn't supported", version)
+	}
+
+	footer := data[len(data)-footerSize:]
+	var fields [7]int
+	for i := range fields {
+		v := binary.LittleEndian.Uint64(footer[i*8:])
+		if v > uint64(len(data)) {
+			return nil, errBadSegment
+		}
+		fields[i] = int(v)
+	}
+	seg := &segment{
+		data:        data,
+		files:       fields[0],
+		terms:       fields[1],
+		forms:       fields[2],
+		filesOffset: fields[3],
+		termsOffset: fields[4],
+		tableOffset: fields[5],
+		formsOffset: fields[6],
+	}
+	if seg.filesOffset < headerSize || seg.termsOffset < seg.filesOffset ||
+		seg.tableOffset < seg.termsOffset || seg.tableOffset+8*seg.terms != seg.formsOffset ||
+		seg.formsOffset > len(data)-footerSize {
+		return nil, errBadSegment
+	}
+
+	seg.names = make([]string, seg.files)
+	r := reader{data: data[seg.filesOffset:seg.termsOffset]}
+	seg.root = r.str()
+	seg.docs = make([]Document, seg.files)
+	seg.analyzer = r.str()
+	if seg.analyzer == "" {
+		seg.analyzer = DefaultAnalyzer
+	}
+	seg.maxDepth = int(r.uvarint())
+	for i := range seg.names {
+		seg.names[i] = r.str()
+		seg.docs[i] = Document{
+			Size:    int64(r.uvarint()),
+			ModTime: r.varint(),
+			Hash:    r.str(),
+			Length:  int(r.uvarint()),
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return seg, nil
+}
+
+// term returns i-th term in sorted order and place of its postings
+func (seg *segment) term(i int) (string, int, int, error) {
+	key, r, err := seg.termKey(i)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	postingsOffset := int(r.uvarint())
+	postingsLength := int(r.uvarint())
+	if r.err != nil {
+		return "", 0, 0, r.err
+	}
+	if postingsOffset < headerSize || postingsLength < 0 || postingsOffset+postingsLength > seg.filesOffset {
+		return "", 0, 0, errBadSegment
+	}
+	return string(key), postingsOffset, postingsLength, nil
+}
+
+// termKey returns bytes of i-th term without copying and reader of the rest of term's entry
+func (seg *segment) termKey(i int) ([]byte, *reader, error) {
+	if i < 0 || i >= seg.terms {
+		return nil, nil, errBadSegment
+	}
+	offset := binary.LittleEndian.Uint64(seg.data[seg.tableOffset+8*i:])
+	if offset >= uint64(seg.tableOffset-seg.termsOffset) {
+		return nil, nil, errBadSegment
+	}
+	r := &reader{data: seg.data[seg.termsOffset+int(offset) : seg.tableOffset]}
+	length := r.uvarint()
+	if r.err != nil || length > uint64(len(r.data)) {
+		return nil, nil, errBadSegment
+	}
+	key := r.data[:length]
+	r.data = r.data[length:]
+	return key, r, nil
+}
+
+// lowerBound returns number of the first term not less than term in sorted order
+func (seg *segment) lowerBound(term string) (int, error) {
+	var findErr error
+	i := sort.Search(seg.terms, func(i int) bool {
+		key, _, err := seg.termKey(i)
+		if err != nil {
+			findErr = err
+			return true
+		}
+		return string(key) >= term
+	})
+	return i, findErr
+}
+
+// find returns number of term in sorted order or -1 if segment hasn't term
+func (seg *segment) find(term string) (int, error) {
+	i, err := seg.lowerBound(term)
+	if err != nil {
+		return -1, err
+	}
+	if i == seg.terms {
+		return -1, nil
+	}
+	if key, _, _ := seg.termKey(i); string(key) != term {
+		return -1, nil
+	}
+	return i, nil
+}
+
+// eachForm calls fn for every surface form of segment with its term in sorted order of forms
+func (seg *segment) eachForm(fn func(form, term string) error) error {
+	r := reader{data: seg.data[seg.formsOffset : len(seg.data)-footerSize]}
+	if seg.forms > len(r.data) {
+		return errBadSegment
+	}
+	for i := 0; i < seg.forms; i++ {
+		form, term := r.str(), r.str()
+		if r.err != nil {
+			return r.err
+		}
+		if err := fn(form, term); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// surfaceForms decodes surface forms of segment, Freq of form is count of files with its term.
+// Forms of terms missing in segment are skipped
+func (seg *segment) surfaceForms() (Forms, error) {
+	forms := make(Forms, 0, seg.forms)
+	err := seg.eachForm(func(form, term string) error {
+		i, err := seg.find(term)
+		if err != nil || i == -1 {
+			return err
+		}
+		_, offset, length, err := seg.term(i)
+		if err != nil {
+			return err
+		}
+		freq, err := seg.docFreq(offset, length)
+		if err != nil {
+			return err
+		}
+		forms = append(forms, Form{Form: form, Word: term, Freq: freq})
+		return nil
+	})
+	return forms, err
+}
+
+// docFreq returns count of files in postings of term
+func (seg *segment) docFreq(offset, length int) (int, error) {
+	r := reader{data: seg.data[offset : offset+length]}
+	count := int(r.uvarint())
+	if r.err != nil || count > length {
+		return 0, errBadSegment
+	}
+	return count, nil
+}
+
+// postings decodes files, positions and spans of term
+func (seg *segment) postings(offset, length int) ([]WordIndex, error) {
+	r := reader{data: seg.data[offset : offset+length]}
+	count := int(r.uvarint())
+	if r.err != nil || count > length {
+		return nil, errBadSegment
+	}
+	sliceIndex := make([]WordIndex, 0, count)
+	id := 0
+	for i := 0; i < count; i++ {
+		id += int(r.uvarint())
+		positionsCount := int(r.uvarint())
+		if r.err != nil || id >= seg.files || positionsCount > length {
+			return nil, errBadSegment
+		}
+		positions := make([]int, positionsCount)
+		position := 0
+		for j := range positions {
+			position += int(r.uvarint())
+			positions[j] = position
+		}
+		item := WordIndex{
+			File:      seg.names[id],
+			Positions: positions,
+		}
+		spansCount := int(r.uvarint())
+		if r.err != nil || spansCount != 0 && spansCount != positionsCount {
+			return nil, errBadSegment
+		}
+		if spansCount != 0 {
+			item.Spans = make([]Span, spansCount)
+		}
+		span := Span{}
+		for j := range item.Spans {
+			span.Offset += int(r.uvarint())
+			span.Length = int(r.uvarint())
+			span.Line += int(r.uvarint())
+			item.Spans[j] = span
+		}
+		sliceIndex = append(sliceIndex, item)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return sliceIndex, nil
+}
+
+// reader decodes numbers and strings from bytes, the first error is kept in err
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errBadSegment
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *reader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errBadSegment
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *reader) str() string {
+	length := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if length > uint64(len(r.data)) {
+		r.err = errBadSegment
+		return ""
+	}
+	s := string(r.data[:length])
+	r.data = r.data[length:]
+	return s
+}
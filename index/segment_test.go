@@ -0,0 +1,132 @@
+package index
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteIndexBinary(t *testing.T) {
+	expect := ReverseIndex{
+		"black": []WordIndex{
+			WordIndex{"3.txt", []int{1}, nil},
+			WordIndex{"dir/2.txt", []int{2, 130, 100000}, []Span{{10, 5, 1}, {700, 5, 12}, {512000, 6, 9000}}},
+		},
+		"cup": []WordIndex{
+			WordIndex{"1.txt", []int{0}, nil},
+			WordIndex{"3.txt", []int{0}, nil},
+			WordIndex{"dir/2.txt", []int{0}, nil},
+		},
+		"чай": []WordIndex{
+			WordIndex{"1.txt", []int{1, 2, 3}, nil},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WriteIndexBinary(buf, expect); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index.bin")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := ReadIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual.Words, expect) {
+		t.Errorf("\n%v isn't equal to expected\n%v", actual, expect)
+	}
+}
+
+func TestReadIndexJSONFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index.json")
+	if err := ioutil.WriteFile(path, []byte(`{"cup":[{"File":"1.txt","Positions":[0]}]}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := ReverseIndex{
+		"cup": []WordIndex{
+			WordIndex{"1.txt", []int{0}, nil},
+		},
+	}
+	actual, err := ReadIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual.Words, expect) {
+		t.Errorf("\n%v isn't equal to expected\n%v", actual, expect)
+	}
+}
+
+func TestParseSegmentCorrupted(t *testing.T) {
+	buf := &bytes.Buffer{}
+	index := ReverseIndex{
+		"cup": []WordIndex{
+			WordIndex{"1.txt", []int{0, 5}, nil},
+		},
+	}
+	if err := WriteIndexBinary(buf, index); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if _, err := parseSegment(data[:len(data)-1]); err == nil {
+		t.Error("truncated index is parsed without error")
+	}
+	if _, err := parseSegment(append([]byte("JSON"), data[4:]...)); err == nil {
+		t.Error("index with wrong magic is parsed without error")
+	}
+}
+
+func TestSegmentSearching(t *testing.T) {
+	index := ReverseIndex{
+		"black": []WordIndex{
+			WordIndex{"3.txt", []int{1}, nil},
+			WordIndex{"2.txt", []int{2}, nil},
+		},
+		"cup": []WordIndex{
+			WordIndex{"1.txt", []int{0}, nil},
+			WordIndex{"2.txt", []int{0}, nil},
+			WordIndex{"3.txt", []int{0}, nil},
+		},
+		"tea": []WordIndex{
+			WordIndex{"1.txt", []int{1}, nil},
+			WordIndex{"2.txt", []int{1}, nil},
+			WordIndex{"3.txt", []int{2}, nil},
+		},
+	}
+
+	segment := openSegment(t, &Index{Words: index})
+
+	for _, word := range []string{"a", "black", "cup", "tea", "zzz"} {
+		actual, err := segment.Lookup(word)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) != len(index[word]) {
+			t.Errorf("lookup of %v: %v isn't equal to expected %v", word, actual, index[word])
+		}
+	}
+
+	expect := []string{"3.txt", "2.txt", "1.txt"}
+	actual, _ := segment.Searching("cup of black tea")
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("\n%v isn't equal to expected\n%v", actual, expect)
+	}
+}
@@ -0,0 +1,157 @@
+package index
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	// snippetWindow is max distance in words between the first and the last keyword of snippet
+	snippetWindow = 16
+	// snippetContext is count of bytes shown before and after keywords of snippet
+	snippetContext = 60
+)
+
+// Snippet is part of file text around keywords, Line is number of its first line.
+// Highlights are places of keywords relative to the start of Text
+type Snippet struct {
+	Line       int
+	Text       string
+	Highlights []Span
+}
+
+// hit is keyword found in file
+type hit struct {
+	keyword  string
+	position int
+	span     Span
+}
+
+// Snippets returns up to count parts of text of found file around its hits
+func (idx *Index) Snippets(result SearchResult, count int) ([]Snippet, error) {
+	return makeSnippets(idx.Root, result.File, resultHits(result), count)
+}
+
+// Snippets returns up to count parts of text of found file around its hits
+func (s *Segment) Snippets(result SearchResult, count int) ([]Snippet, error) {
+	return makeSnippets(s.seg.root, result.File, resultHits(result), count)
+}
+
+// SnippetsDB returns up to count parts of text of file found in db around its hits, root is indexed folder
+func SnippetsDB(root string, result SearchResult, count int) ([]Snippet, error) {
+	return makeSnippets(root, result.File, resultHits(result), count)
+}
+
+// resultHits returns hits of search result with places in file sorted by position,
+// hits without places are skipped
+func resultHits(result SearchResult) []hit {
+	var hits []hit
+	for i, h := range result.Hits {
+		if i >= len(result.Spans) || result.Spans[i].Line == 0 {
+			continue
+		}
+		hits = append(hits, hit{
+			keyword:  h.Keyword,
+			position: h.Position,
+			span:     result.Spans[i],
+		})
+	}
+	return hits
+}
+
+// makeSnippets reads file and cuts snippets around the densest clusters of hits
+func makeSnippets(root, file string, hits []hit, count int) ([]Snippet, error) {
+	if len(hits) == 0 || count < 1 {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(file)))
+	if err != nil {
+		return nil, err
+	}
+
+	var snippets []Snippet
+	for _, cluster := range densestClusters(hits, count) {
+		if snippet, ok := cutSnippet(data, cluster); ok {
+			snippets = append(snippets, snippet)
+		}
+	}
+	return snippets, nil
+}
+
+// densestClusters returns up to count not overlapping groups of hits within snippetWindow words.
+// Groups with more different keywords, then with more hits are chosen, groups are sorted by position
+func densestClusters(hits []hit, count int) [][]hit {
+	used := make([]bool, len(hits))
+	var clusters [][]hit
+	for len(clusters) < count {
+		bestStart, bestEnd, bestUnique := -1, -1, 0
+		for i := range hits {
+			if used[i] {
+				continue
+			}
+			unique := map[string]bool{}
+			j := i
+			for ; j < len(hits) && !used[j] && hits[j].position-hits[i].position < snippetWindow; j++ {
+				unique[hits[j].keyword] = true
+			}
+			if len(unique) > bestUnique || len(unique) == bestUnique && j-i > bestEnd-bestStart {
+				bestStart, bestEnd, bestUnique = i, j, len(unique)
+			}
+		}
+		if bestStart == -1 {
+			break
+		}
+		for i := bestStart; i < bestEnd; i++ {
+			used[i] = true
+		}
+		clusters = append(clusters, hits[bestStart:bestEnd])
+	}
+	sort.Slice(clusters, func(i, j int) bool { return clusters[i][0].position < clusters[j][0].position })
+	return clusters
+}
+
+// cutSnippet returns text around hits cut by white spaces, false is returned if file is changed
+// after indexing and hits are out of text
+func cutSnippet(data []byte, hits []hit) (Snippet, bool) {
+	last := hits[len(hits)-1].span
+	start, end := hits[0].span.Offset, last.Offset+last.Length
+	if start < 0 || end > len(data) || start > end {
+		return Snippet{}, false
+	}
+
+	from := start - snippetContext
+	if from <= 0 {
+		from = 0
+	} else if i := bytes.IndexAny(data[from:start], " \t\r\n"); i >= 0 {
+		from += i + 1
+	} else {
+		for from < start && !utf8.RuneStart(data[from]) {
+			from++
+		}
+	}
+
+	to := end + snippetContext
+	if to >= len(data) {
+		to = len(data)
+	} else if i := bytes.LastIndexAny(data[end:to], " \t\r\n"); i >= 0 {
+		to = end + i
+	} else {
+		for to > end && !utf8.RuneStart(data[to]) {
+			to--
+		}
+	}
+
+	snippet := Snippet{
+		Line: hits[0].span.Line - bytes.Count(data[from:start], []byte{'\n'}),
+		Text: string(data[from:to]),
+	}
+	for _, h := range hits {
+		span := h.span
+		span.Offset -= from
+		snippet.Highlights = append(snippet.Highlights, span)
+	}
+	return snippet, true
+}
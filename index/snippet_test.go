@@ -0,0 +1,80 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndexSnippets(t *testing.T) {
+	text := "Green tea is here.\n" + strings.Repeat("Nothing interesting. ", 10) +
+		"\nBlack tea in a big cup.\n" + strings.Repeat("Nothing interesting. ", 10) + "\nTea"
+	root := makeFolder(t, map[string]string{
+		"1.txt": text,
+	})
+	defer os.RemoveAll(root)
+
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := idx.Search("cup of black tea", SearchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results.Matches) != 1 {
+		t.Fatalf("%v isn't equal to expected %v", results.Files(), []string{"1.txt"})
+	}
+	actual, err := idx.Snippets(results.Matches[0], 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Snippet{
+		{
+			Line:       1,
+			Text:       "Green tea is here.\nNothing interesting. Nothing interesting. Nothing",
+			Highlights: []Span{{6, 3, 1}},
+		},
+		{
+			Line:       2,
+			Text:       "interesting. Nothing interesting. Nothing interesting. \nBlack tea in a big cup.\nNothing interesting. Nothing interesting. Nothing",
+			Highlights: []Span{{56, 5, 3}, {62, 3, 3}, {75, 3, 3}},
+		},
+	}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("\n%+v isn't equal to expected\n%+v", actual, expect)
+	}
+	for _, snippet := range actual {
+		for _, span := range snippet.Highlights {
+			if word := strings.ToLower(snippet.Text[span.Offset : span.Offset+span.Length]); !strings.Contains("black tea cup", word) {
+				t.Errorf("highlight %v points to %q", span, word)
+			}
+		}
+	}
+
+	missing := SearchResult{File: "2.txt", Hits: []Hit{{"tea", 0}}, Spans: []Span{{0, 3, 1}}}
+	if actual, err := idx.Snippets(missing, 2); err == nil {
+		t.Errorf("snippets %v of missing file are returned without error", actual)
+	}
+	if actual, err := idx.Snippets(SearchResult{File: "1.txt", Hits: []Hit{{"tea", 1}}}, 2); err != nil || actual != nil {
+		t.Errorf("snippets %v of hits without spans are returned, err %v", actual, err)
+	}
+}
+
+func TestDensestClusters(t *testing.T) {
+	hits := []hit{
+		{keyword: "tea", position: 0},
+		{keyword: "tea", position: 1},
+		{keyword: "tea", position: 2},
+		{keyword: "cup", position: 40},
+		{keyword: "tea", position: 41},
+		{keyword: "tea", position: 100},
+	}
+	expect := [][]hit{hits[:3], hits[3:5]}
+	actual := densestClusters(hits, 2)
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+}
@@ -0,0 +1,140 @@
+package index
+
+import (
+	"sort"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/polisgo2020/search-tarival/model"
+)
+
+// Store is backend of reverse index. Besides searching it suggests corrections and completions of words,
+// returns snippets and state of indexed files and statistics of index.
+// It's implemented by Index, Segment and DB
+type Store interface {
+	Searcher
+	Suggest(searchPhrase string) (string, error)
+	Complete(prefix string, count int) ([]Completion, error)
+	Snippets(result SearchResult, count int) ([]Snippet, error)
+	Document(file string) (Document, bool, error)
+	Stats() (IndexStats, error)
+}
+
+// Updater is Store which can be changed, Update makes it actual with files of indexed folder
+type Updater interface {
+	Store
+	Update(opts Options) (Changes, error)
+}
+
+var (
+	_ Store   = (*Index)(nil)
+	_ Store   = (*Segment)(nil)
+	_ Store   = (*DB)(nil)
+	_ Updater = (*Index)(nil)
+)
+
+// IndexStats is statistics of index, Words is count of different indexed words
+// and AvgLength is average count of tokens of indexed files
+type IndexStats struct {
+	Files     int
+	Words     int
+	AvgLength float64
+}
+
+// Document returns state of indexed file, false is returned if file isn't indexed
+func (idx *Index) Document(file string) (Document, bool, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	doc, ok := idx.Manifest[file]
+	return doc, ok, nil
+}
+
+// Stats returns statistics of index
+func (idx *Index) Stats() (IndexStats, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	docs := idx.Manifest.collection()
+	return IndexStats{Files: docs.files, Words: len(idx.Words), AvgLength: docs.avgLength}, nil
+}
+
+// Document returns state of indexed file, false is returned if file isn't indexed
+func (s *Segment) Document(file string) (Document, bool, error) {
+	names := s.seg.names
+	i := sort.SearchStrings(names, file)
+	if i == len(names) || names[i] != file {
+		return Document{}, false, nil
+	}
+	return s.seg.docs[i], true, nil
+}
+
+// Stats returns statistics of segment
+func (s *Segment) Stats() (IndexStats, error) {
+	return IndexStats{Files: s.docs.files, Words: s.seg.terms, AvgLength: s.docs.avgLength}, nil
+}
+
+// DB is reverse index in db, Analyzer must be the same as for indexing.
+// Root is indexed folder, it's used for snippets
+type DB struct {
+	DB       *pg.DB
+	Analyzer Analyzer
+	Root     string
+}
+
+// NewDB returns reverse index in db analyzed by analyzer of folder at root
+func NewDB(db *pg.DB, analyzer Analyzer, root string) *DB {
+	return &DB{DB: db, Analyzer: analyzer, Root: root}
+}
+
+// Search is func for search with reverse index in db, found files are ranked by opts
+func (d *DB) Search(searchPhrase string, opts SearchOptions) (Results, error) {
+	return SearchDB(d.DB, d.Analyzer, searchPhrase, opts)
+}
+
+// Suggest returns search phrase with missing words replaced by the closest words in db
+func (d *DB) Suggest(searchPhrase string) (string, error) {
+	return SuggestDB(d.DB, d.Analyzer, searchPhrase)
+}
+
+// Complete returns up to count words in db starting with prefix
+func (d *DB) Complete(prefix string, count int) ([]Completion, error) {
+	return CompleteDB(d.DB, prefix, count)
+}
+
+// Snippets returns up to count parts of text of found file around its hits
+func (d *DB) Snippets(result SearchResult, count int) ([]Snippet, error) {
+	return SnippetsDB(d.Root, result, count)
+}
+
+// Document returns state of indexed file, false is returned if file isn't indexed
+func (d *DB) Document(file string) (Document, bool, error) {
+	dbFile := model.File{
+		File: file,
+	}
+	if err := dbFile.SelectRow(d.DB); err != nil {
+		if err == pg.ErrNoRows {
+			return Document{}, false, nil
+		}
+		return Document{}, false, err
+	}
+	return fileDocument(dbFile), true, nil
+}
+
+// Stats returns statistics of index in db
+func (d *DB) Stats() (IndexStats, error) {
+	fileLengths, err := model.SelectFileLengths(d.DB)
+	if err != nil {
+		return IndexStats{}, err
+	}
+	words, err := model.CountWords(d.DB)
+	if err != nil {
+		return IndexStats{}, err
+	}
+	stats := IndexStats{Files: len(fileLengths), Words: words}
+	total := 0
+	for _, length := range fileLengths {
+		total += length
+	}
+	if len(fileLengths) != 0 {
+		stats.AvgLength = float64(total) / float64(len(fileLengths))
+	}
+	return stats, nil
+}
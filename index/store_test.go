@@ -0,0 +1,49 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt": "cup black tea",
+		"2.txt": "black cup tea tea green",
+	})
+	defer os.RemoveAll(root)
+
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	segment := openSegment(t, idx)
+
+	stores := map[string]Store{
+		"index":   idx,
+		"segment": segment,
+	}
+	expect := IndexStats{Files: 2, Words: 4, AvgLength: 4}
+	for name, store := range stores {
+		stats, err := store.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(stats, expect) {
+			t.Errorf("%v: %+v isn't equal to expected %+v", name, stats, expect)
+		}
+
+		doc, ok, err := store.Document("2.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || !reflect.DeepEqual(doc, idx.Manifest["2.txt"]) {
+			t.Errorf("%v: %+v isn't equal to expected %+v", name, doc, idx.Manifest["2.txt"])
+		}
+		for _, file := range []string{"0.txt", "10.txt", "3.txt"} {
+			if _, ok, _ := store.Document(file); ok {
+				t.Errorf("%v: not indexed file %v is found", name, file)
+			}
+		}
+	}
+}
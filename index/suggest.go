@@ -0,0 +1,188 @@
+package index
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/polisgo2020/search-tarival/model"
+)
+
+// Suggest returns search phrase with missing words replaced by the closest indexed words,
+// empty string is returned if all words of search phrase are indexed or nothing is close to them
+func (idx *Index) Suggest(searchPhrase string) (string, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	analyzer, err := AnalyzerByName(idx.Analyzer)
+	if err != nil {
+		return "", err
+	}
+	return suggest(idx.source(), analyzer, searchPhrase)
+}
+
+// Suggest returns search phrase with missing words replaced by the closest words of segment,
+// empty string is returned if all words of search phrase are indexed or nothing is close to them
+func (s *Segment) Suggest(searchPhrase string) (string, error) {
+	return suggest(s.source(), s.analyzer, searchPhrase)
+}
+
+// SuggestDB returns search phrase with missing words replaced by the closest words in db,
+// empty string is returned if all words of search phrase are indexed or nothing is close to them
+func SuggestDB(db *pg.DB, analyzer Analyzer, searchPhrase string) (string, error) {
+	files, err := model.SelectFiles(db)
+	if err != nil {
+		return "", err
+	}
+	src, err := sourceDB(db, files)
+	if err != nil {
+		return "", err
+	}
+	return suggest(src, analyzer, searchPhrase)
+}
+
+// suggest replaces terms of search phrase which words aren't found in src. Words within edit distance
+// are candidates, the closest one is chosen and candidates with the same distance are chosen
+// by count of files with them. Terms with several words, wildcards and phrases aren't replaced.
+// Surface forms of words are suggested if src has them, otherwise indexed words are suggested
+func suggest(src source, analyzer Analyzer, searchPhrase string) (string, error) {
+	root, err := ParseQuery(searchPhrase)
+	if err != nil {
+		return "", err
+	}
+
+	var terms []*Term
+	walkTerms(root, func(term *Term) {
+		terms = append(terms, term)
+	})
+	sort.Slice(terms, func(i, j int) bool { return terms[i].Pos < terms[j].Pos })
+
+	var b strings.Builder
+	prev, changed := 0, false
+	for _, term := range terms {
+		if isWildcard(term.Text) {
+			continue
+		}
+		keywords, err := analyzer.AnalyzeQuery(term.Text)
+		if err != nil {
+			return "", err
+		}
+		if len(keywords) != 1 {
+			continue
+		}
+		word, err := correctWord(src, surfaceForm(term.Text), keywords[0].Variants)
+		if err != nil {
+			return "", err
+		}
+		if word == "" {
+			continue
+		}
+		b.WriteString(searchPhrase[prev:term.Pos])
+		b.WriteString(word)
+		prev, changed = term.Pos+len(term.Text), true
+	}
+	if !changed {
+		return "", nil
+	}
+	b.WriteString(searchPhrase[prev:])
+	return b.String(), nil
+}
+
+// correctWord returns the closest surface form or indexed word to missing word with variants,
+// empty string is returned if word is indexed or there is no close word
+func correctWord(src source, word string, variants []string) (string, error) {
+	for _, variant := range variants {
+		sliceIndex, err := src.lookup(variant)
+		if err != nil {
+			return "", err
+		}
+		if len(sliceIndex) != 0 {
+			return "", nil
+		}
+	}
+	if src.fuzzyForms != nil {
+		return correctForm(src, word)
+	}
+
+	best, bestDistance, bestFreq := "", 0, 0
+	target := []rune(variants[0])
+	distance := autoDistance(variants[0], 2)
+	if distance == 0 {
+		return "", nil
+	}
+	words, err := src.fuzzy(variants[0], distance, DefaultMaxExpansions)
+	if err != nil {
+		return "", err
+	}
+	for _, word := range words {
+		d, _ := editDistance(target, []rune(word), distance)
+		if best != "" && d > bestDistance {
+			break
+		}
+		sliceIndex, err := src.lookup(word)
+		if err != nil {
+			return "", err
+		}
+		if freq := countFiles(sliceIndex); best == "" || freq > bestFreq {
+			best, bestDistance, bestFreq = word, d, freq
+		}
+	}
+	return best, nil
+}
+
+// correctForm returns the closest surface form to word, forms with the same distance are chosen
+// by count of files with them
+func correctForm(src source, word string) (string, error) {
+	distance := autoDistance(word, 2)
+	if distance == 0 {
+		return "", nil
+	}
+	forms, err := src.fuzzyForms(word, distance, DefaultMaxExpansions)
+	if err != nil {
+		return "", err
+	}
+	best, bestDistance, bestFreq := "", 0, 0
+	target := []rune(word)
+	for _, form := range forms {
+		d, _ := editDistance(target, []rune(form.Form), distance)
+		if best != "" && d > bestDistance {
+			break
+		}
+		if best == "" || form.Freq > bestFreq {
+			best, bestDistance, bestFreq = form.Form, d, form.Freq
+		}
+	}
+	return best, nil
+}
+
+// countFiles returns count of different files of positions
+func countFiles(sliceIndex []WordIndex) int {
+	files := map[string]bool{}
+	for _, item := range sliceIndex {
+		files[item.File] = true
+	}
+	return len(files)
+}
+
+// walkTerms calls fn for every Term of query
+func walkTerms(node Node, fn func(term *Term)) {
+	var nodes []Node
+	switch n := node.(type) {
+	case *Term:
+		fn(n)
+	case *Not:
+		walkTerms(n.Node, fn)
+	case *Required:
+		walkTerms(n.Node, fn)
+	case *Near:
+		nodes = n.Nodes
+	case *And:
+		nodes = n.Nodes
+	case *Or:
+		nodes = n.Nodes
+	case *Group:
+		nodes = n.Nodes
+	}
+	for _, node := range nodes {
+		walkTerms(node, fn)
+	}
+}
@@ -0,0 +1,73 @@
+package index
+
+import (
+	"os"
+	"testing"
+)
+
+func TestIndexSuggest(t *testing.T) {
+	idx := NewIndex("")
+	idx.Analyzer = DefaultAnalyzer
+	idx.Words.addFileInIndex("1.txt", analyze(t, "full text search"))
+	idx.Words.addFileInIndex("2.txt", analyze(t, "search engine"))
+	idx.Words.addFileInIndex("3.txt", analyze(t, "bench and beach"))
+	idx.Words.addFileInIndex("4.txt", analyze(t, "beach"))
+	idx.Words.addFileInIndex("5.txt", analyze(t, "search"))
+
+	cases := map[string]string{
+		"serach":              "search",
+		"full txt serach":     "full text search",
+		"Serach AND -engin~1": "search AND -engin~1",
+		"search engine":       "",
+		"seach":               "search",
+		"beech":               "beach",
+		"reach":               "",
+		"xyz":                 "",
+		"txt*":                "",
+		`"txt serach"`:        "",
+	}
+	for text, expect := range cases {
+		actual, err := idx.Suggest(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual != expect {
+			t.Errorf("%q: %q isn't equal to expected %q", text, actual, expect)
+		}
+	}
+}
+
+func TestSuggestForms(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt": "Happy configuration",
+		"2.txt": "happy people",
+		"3.txt": "hope",
+	})
+	defer os.RemoveAll(root)
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{}); err != nil {
+		t.Fatal(err)
+	}
+	segment := openSegment(t, idx)
+
+	suggests := map[string]func(searchPhrase string) (string, error){
+		"index":   idx.Suggest,
+		"segment": segment.Suggest,
+	}
+	cases := map[string]string{
+		"configuraton hapy": "configuration happy",
+		"Hapy -peple":       "happy -people",
+		"happy":             "",
+	}
+	for name, suggest := range suggests {
+		for text, expect := range cases {
+			actual, err := suggest(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != expect {
+				t.Errorf("%v %q: %q isn't equal to expected %q", name, text, actual, expect)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package index
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// UnicodeTokenizer splits text by word boundaries of Unicode text segmentation (UAX #29).
+// Words are sequences of letters, numbers and connectors like "_", every ideograph is a word.
+// Punctuation inside words splits them, except the cases enabled by options
+type UnicodeTokenizer struct {
+	// Hyphens keeps words joined by hyphen together, "e-mail" is one word
+	Hyphens bool
+	// Apostrophes keeps apostrophes and dots between letters, "don't" is one word
+	Apostrophes bool
+	// Numbers keeps separators between digits, "1,000.50" is one word
+	Numbers bool
+}
+
+// DefaultTokenizer is tokenizer of builtin analyzers, it follows rules of UAX #29
+var DefaultTokenizer = UnicodeTokenizer{Apostrophes: true, Numbers: true}
+
+// classes of runes for word boundaries
+type runeClass int
+
+const (
+	otherClass runeClass = iota
+	letterClass
+	numberClass
+	connectorClass
+	ideographClass
+	extendClass
+	midLetterClass
+	midNumClass
+	midNumLetClass
+	hyphenClass
+)
+
+func classify(r rune) runeClass {
+	switch r {
+	case '\'', '.', '\u2018', '\u2019', '\u2024', '\ufe52', '\uff07', '\uff0e':
+		return midNumLetClass
+	case ',', ';', '\u066c', '\ufe50', '\ufe54', '\uff0c', '\uff1b':
+		return midNumClass
+	case '\u00b7', '\u0387', '\u05f4', '\u2027', '\ufe13', '\ufe55':
+		return midLetterClass
+	case '-', '\u2010', '\u2011':
+		return hyphenClass
+	}
+	switch {
+	case unicode.In(r, unicode.Han, unicode.Hiragana):
+		return ideographClass
+	case unicode.IsLetter(r):
+		return letterClass
+	case unicode.Is(unicode.Nd, r):
+		return numberClass
+	case unicode.Is(unicode.Pc, r):
+		return connectorClass
+	case unicode.In(r, unicode.Mn, unicode.Mc, unicode.Me), r == '\u200d':
+		return extendClass
+	}
+	return otherClass
+}
+
+// joins reports if middle rune of class mid joins rune of class prev with rune of class next
+func (t UnicodeTokenizer) joins(prev, mid, next runeClass) bool {
+	switch {
+	case prev == letterClass && next == letterClass:
+		return mid == midLetterClass || mid == midNumLetClass && t.Apostrophes || mid == hyphenClass && t.Hyphens
+	case prev == numberClass && next == numberClass:
+		return (mid == midNumClass || mid == midNumLetClass) && t.Numbers || mid == hyphenClass && t.Hyphens
+	case prev != connectorClass && next != connectorClass:
+		return mid == hyphenClass && t.Hyphens
+	}
+	return false
+}
+
+// Tokenize reads text by runes without loading the whole text in memory
+func (t UnicodeTokenizer) Tokenize(r io.Reader, emit func(word string, span Span)) error {
+	reader := bufio.NewReader(r)
+	var (
+		word    strings.Builder
+		span    Span
+		last    runeClass
+		pending rune
+		midOf   runeClass
+	)
+	offset, line := 0, 1
+	tooLong, skipped := false, false
+	write := func(r rune) {
+		if word.Len()+utf8.RuneLen(r) > maxWordLength {
+			tooLong = true
+			return
+		}
+		word.WriteRune(r)
+	}
+	flush := func() {
+		if tooLong {
+			skipped = true
+		} else if word.Len() != 0 {
+			span.Length = word.Len()
+			emit(word.String(), span)
+		}
+		word.Reset()
+		tooLong = false
+		pending = 0
+	}
+
+	for {
+		r, size, err := reader.ReadRune()
+		if err == io.EOF {
+			flush()
+			if skipped {
+				return ErrWordTooLong
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		class := classify(r)
+		switch class {
+		case letterClass, numberClass, connectorClass:
+			if pending != 0 {
+				if t.joins(last, midOf, class) {
+					write(pending)
+				} else {
+					flush()
+				}
+				pending = 0
+			}
+			if word.Len() == 0 {
+				span = Span{Offset: offset, Line: line}
+			}
+			write(r)
+			last = class
+		case ideographClass:
+			flush()
+			emit(string(r), Span{Offset: offset, Length: size, Line: line})
+		case extendClass:
+			if word.Len() != 0 && pending == 0 {
+				write(r)
+			} else {
+				flush()
+			}
+		case midLetterClass, midNumClass, midNumLetClass, hyphenClass:
+			if word.Len() != 0 && pending == 0 {
+				pending, midOf = r, class
+			} else {
+				flush()
+			}
+		default:
+			flush()
+		}
+		offset += size
+		if r == '\n' {
+			line++
+		}
+	}
+}
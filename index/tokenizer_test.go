@@ -0,0 +1,126 @@
+package index
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnicodeTokenizer(t *testing.T) {
+	text := "foo,bar e-mail path/to/file don't 1,000.50 snake_case end. «Поиск»—быстрый 東京 café"
+	cases := []struct {
+		tokenizer UnicodeTokenizer
+		expect    []string
+	}{
+		{
+			tokenizer: DefaultTokenizer,
+			expect: []string{"foo", "bar", "e", "mail", "path", "to", "file", "don't", "1,000.50",
+				"snake_case", "end", "Поиск", "быстрый", "東", "京", "café"},
+		},
+		{
+			tokenizer: UnicodeTokenizer{Hyphens: true},
+			expect: []string{"foo", "bar", "e-mail", "path", "to", "file", "don", "t", "1", "000", "50",
+				"snake_case", "end", "Поиск", "быстрый", "東", "京", "café"},
+		},
+	}
+	for _, c := range cases {
+		var actual []string
+		err := c.tokenizer.Tokenize(strings.NewReader(text), func(word string, _ Span) {
+			actual = append(actual, word)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, c.expect) {
+			t.Errorf("%+v: %v isn't equal to expected %v", c.tokenizer, actual, c.expect)
+		}
+	}
+}
+
+func TestTokenizerSpans(t *testing.T) {
+	text := "  Поиск,\nof  e-mail\n\nend"
+	expect := map[Tokenizer][]Span{
+		DefaultTokenizer:      []Span{{2, 10, 1}, {14, 2, 2}, {18, 1, 2}, {20, 4, 2}, {26, 3, 4}},
+		WhitespaceTokenizer{}: []Span{{2, 11, 1}, {14, 2, 2}, {18, 6, 2}, {26, 3, 4}},
+	}
+	for tokenizer, spans := range expect {
+		var actual []Span
+		err := tokenizer.Tokenize(strings.NewReader(text), func(word string, span Span) {
+			if text[span.Offset:span.Offset+span.Length] != word {
+				t.Errorf("%T: span %v doesn't match word %q", tokenizer, span, word)
+			}
+			actual = append(actual, span)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, spans) {
+			t.Errorf("%T: %v isn't equal to expected %v", tokenizer, actual, spans)
+		}
+	}
+}
+
+func TestTokenizerLongWords(t *testing.T) {
+	long := strings.Repeat("a", maxWordLength+10)
+	text := "cup " + long + " black\ntea"
+	expect := []Span{{0, 3, 1}, {len(long) + 5, 5, 1}, {len(long) + 11, 3, 2}}
+	for _, tokenizer := range []Tokenizer{DefaultTokenizer, WhitespaceTokenizer{}} {
+		var actual []Span
+		err := tokenizer.Tokenize(strings.NewReader(text), func(word string, span Span) {
+			if text[span.Offset:span.Offset+span.Length] != word {
+				t.Errorf("%T: span %v doesn't match word %q", tokenizer, span, word)
+			}
+			actual = append(actual, span)
+		})
+		if err != ErrWordTooLong {
+			t.Errorf("%T: %v isn't equal to expected %v", tokenizer, err, ErrWordTooLong)
+		}
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%T: %v isn't equal to expected %v", tokenizer, actual, expect)
+		}
+	}
+
+	root := makeFolder(t, map[string]string{
+		"1.txt": text,
+	})
+	defer os.RemoveAll(root)
+	idx, err := IndexingFolderWith(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := idx.Searching("black tea")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"1.txt"}; !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+}
+
+func TestIndexingFolderPunctuation(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt": "Send e-mail to foo,bar",
+		"2.txt": "Open path/to/file",
+	})
+	defer os.RemoveAll(root)
+
+	idx, err := IndexingFolderWith(root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string][]string{
+		"mail": []string{"1.txt"},
+		"bar":  []string{"1.txt"},
+		"file": []string{"2.txt"},
+	}
+	for phrase, expect := range cases {
+		actual, err := idx.Searching(phrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%q: %v isn't equal to expected %v", phrase, actual, expect)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package index
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/polisgo2020/search-tarival/model"
+	"github.com/rs/zerolog/log"
+)
+
+// Op is kind of file change
+type Op int
+
+// Kinds of file changes
+const (
+	Create Op = iota
+	Modify
+	Delete
+	Rename
+)
+
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Modify:
+		return "modify"
+	case Delete:
+		return "delete"
+	case Rename:
+		return "rename"
+	}
+	return "unknown"
+}
+
+// Event is change of file in indexed folder, OldName is set for renamed files.
+// Info is nil for deleted files
+type Event struct {
+	Op      Op
+	Name    string
+	OldName string
+	Info    os.FileInfo
+}
+
+// Events is changes of files found by one scan of folder
+type Events []Event
+
+// sendChanged sends created and modified files to processFiles
+func (events Events) sendChanged(send func(name string, info os.FileInfo) error) error {
+	for _, event := range events {
+		if event.Op != Create && event.Op != Modify {
+			continue
+		}
+		if err := send(event.Name, event.Info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanFolder compares files of folder with manifest and returns changes of files.
+// Created file is reported as renamed if it has the same content as one of deleted files
+func scanFolder(root string, maxDepth int, manifest Manifest) (Events, error) {
+	var events Events
+	seen := map[string]bool{}
+	err := walkFiles(root, maxDepth, func(name string, info os.FileInfo) error {
+		seen[name] = true
+		doc, ok := manifest[name]
+		switch {
+		case !ok:
+			events = append(events, Event{Op: Create, Name: name, Info: info})
+		case doc.Size != info.Size() || doc.ModTime != info.ModTime().UnixNano():
+			events = append(events, Event{Op: Modify, Name: name, Info: info})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted []string
+	for name := range manifest {
+		if !seen[name] {
+			deleted = append(deleted, name)
+		}
+	}
+	sort.Strings(deleted)
+	for _, name := range deleted {
+		events = append(events, Event{Op: Delete, Name: name})
+	}
+
+	return detectRenames(root, events, manifest)
+}
+
+// detectRenames replaces pairs of created and deleted files with equal content by renaming.
+// Only created files with size of some deleted file are read
+func detectRenames(root string, events Events, manifest Manifest) (Events, error) {
+	deletedBySize := map[int64][]int{}
+	for i, event := range events {
+		if doc := manifest[event.Name]; event.Op == Delete && doc.Hash != "" {
+			deletedBySize[doc.Size] = append(deletedBySize[doc.Size], i)
+		}
+	}
+	if len(deletedBySize) == 0 {
+		return events, nil
+	}
+
+	renamed := map[int]bool{}
+	for i, event := range events {
+		if event.Op != Create {
+			continue
+		}
+		candidates := deletedBySize[event.Info.Size()]
+		if len(candidates) == 0 {
+			continue
+		}
+		hash, err := hashFile(root, event.Name)
+		if err != nil {
+			return nil, err
+		}
+		for k, j := range candidates {
+			if manifest[events[j].Name].Hash != hash {
+				continue
+			}
+			events[i].Op = Rename
+			events[i].OldName = events[j].Name
+			renamed[j] = true
+			deletedBySize[event.Info.Size()] = append(candidates[:k:k], candidates[k+1:]...)
+			break
+		}
+	}
+
+	result := events[:0]
+	for i, event := range events {
+		if !renamed[i] {
+			result = append(result, event)
+		}
+	}
+	return result, nil
+}
+
+// watch calls poll every interval until stop is closed, errors of poll are logged
+func watch(interval time.Duration, stop <-chan struct{}, poll func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := poll(); err != nil {
+				log.Error().Err(err).Msg("Watching err")
+			}
+		}
+	}
+}
+
+// Watch checks indexed folder every interval and applies changes of files to index until stop is closed.
+// Subfolders are watched to the depth used for indexing, MaxDepth of opts is ignored.
+// Index can be searched while watching
+func (idx *Index) Watch(interval time.Duration, opts Options, stop <-chan struct{}) {
+	watch(interval, stop, func() error {
+		events, err := scanFolder(idx.Root, idx.MaxDepth, idx.Manifest)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		changes, err := idx.Apply(events, opts)
+		if err != nil {
+			return err
+		}
+		log.Info().
+			Int("added", changes.Added).
+			Int("updated", changes.Updated).
+			Int("renamed", changes.Renamed).
+			Int("removed", changes.Removed).
+			Msg("Index is updated")
+		return nil
+	})
+}
+
+// WatchDB checks folder every interval and applies changes of files to index in db until stop is closed.
+// State of indexed files is loaded from db, so files changed while index wasn't watched are updated
+// on the first check. Subfolders are watched to the depth used for indexing, MaxDepth of opts is ignored
+func WatchDB(db *pg.DB, root string, interval time.Duration, opts Options, stop <-chan struct{}) error {
+	if err := checkAnalyzerDB(db, opts.analyzer().Name()); err != nil {
+		return err
+	}
+	index := dbIndex{db: db}
+	manifest, err := index.manifest()
+	if err != nil {
+		return err
+	}
+	maxDepth, err := depthDB(db)
+	if err != nil {
+		return err
+	}
+
+	watch(interval, stop, func() error {
+		events, err := scanFolder(root, maxDepth, manifest)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		return applyChanges(index, root, manifest, events, opts)
+	})
+	return nil
+}
+
+// watchedIndex is storage of index changed by watching. Changes of every file are saved atomically,
+// so state of file returned by manifest matches its indexed words
+type watchedIndex interface {
+	manifest() (Manifest, error)
+	addFile(name string, doc Document, tokens []Token) error
+	saveState(name string, doc Document) error
+	deleteFile(name string) error
+	renameFile(oldName, newName string, doc Document) error
+}
+
+// dbIndex is index in db changed by watching
+type dbIndex struct {
+	db *pg.DB
+}
+
+func (d dbIndex) manifest() (Manifest, error) {
+	return manifestDB(d.db)
+}
+
+func (d dbIndex) addFile(name string, doc Document, tokens []Token) error {
+	return addFileInDB(d.db, name, doc, tokens)
+}
+
+func (d dbIndex) saveState(name string, doc Document) error {
+	file := fileDB(name, doc)
+	return file.UpdateState(d.db)
+}
+
+func (d dbIndex) deleteFile(name string) error {
+	return model.DeleteFile(d.db, name)
+}
+
+func (d dbIndex) renameFile(oldName, newName string, doc Document) error {
+	return d.db.RunInTransaction(func(tx *pg.Tx) error {
+		if err := model.RenameFile(tx, oldName, newName); err != nil {
+			return err
+		}
+		file := fileDB(newName, doc)
+		return file.UpdateState(tx)
+	})
+}
+
+// applyChanges applies changes of files to watched index and manifest of indexed files.
+// Manifest is changed only after the change of file is saved, so failed files are found by the next scan
+func applyChanges(index watchedIndex, root string, manifest Manifest, events Events, opts Options) error {
+	for _, event := range events {
+		switch event.Op {
+		case Delete:
+			if err := index.deleteFile(event.Name); err != nil {
+				return err
+			}
+			delete(manifest, event.Name)
+			log.Info().Str("File", event.Name).Msg("File is removed from index")
+		case Rename:
+			doc := manifest[event.OldName]
+			doc.ModTime = event.Info.ModTime().UnixNano()
+			if err := index.renameFile(event.OldName, event.Name, doc); err != nil {
+				return err
+			}
+			manifest[event.Name] = doc
+			delete(manifest, event.OldName)
+			log.Info().Str("File", event.Name).Str("Old", event.OldName).Msg("File is renamed in index")
+		}
+	}
+
+	mu := &sync.Mutex{}
+	known := func(name string) (Document, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		return manifest.document(name)
+	}
+	return processFiles(root, opts, known, events.sendChanged, func(_ int, file fileData) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if doc, ok := manifest[file.name]; ok && doc.Hash == file.doc.Hash {
+			if err := index.saveState(file.name, file.doc); err != nil {
+				return err
+			}
+			manifest[file.name] = file.doc
+			return nil
+		}
+		if err := index.addFile(file.name, file.doc, file.tokens); err != nil {
+			return err
+		}
+		manifest[file.name] = file.doc
+		return nil
+	})
+}
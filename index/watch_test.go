@@ -0,0 +1,290 @@
+package index
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScanFolder(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt":     "cup of tea",
+		"2.txt":     "black tea",
+		"dir/3.txt": "black coffee",
+	})
+	defer os.RemoveAll(root)
+
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "1.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(root, "dir", "3.txt"), filepath.Join(root, "3.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "2.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "4.txt"), []byte("milk"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := scanFolder(root, 0, idx.Manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, event := range events {
+		actual = append(actual, event.Op.String()+" "+event.OldName+" "+event.Name)
+	}
+	expect := []string{"modify  1.txt", "rename dir/3.txt 3.txt", "create  4.txt", "delete  2.txt"}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("\n%v isn't equal to expected\n%v", actual, expect)
+	}
+
+	changes, err := idx.Apply(events, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (Changes{Added: 1, Renamed: 1, Removed: 1}); changes != expect {
+		t.Errorf("%+v isn't equal to expected %+v", changes, expect)
+	}
+	expectIndex := ReverseIndex{
+		"black": []WordIndex{
+			WordIndex{"3.txt", []int{0}, nil},
+		},
+		"coffe": []WordIndex{
+			WordIndex{"3.txt", []int{1}, nil},
+		},
+		"cup": []WordIndex{
+			WordIndex{"1.txt", []int{0}, nil},
+		},
+		"milk": []WordIndex{
+			WordIndex{"4.txt", []int{0}, nil},
+		},
+		"tea": []WordIndex{
+			WordIndex{"1.txt", []int{2}, nil},
+		},
+	}
+	if !reflect.DeepEqual(withoutSpans(idx.Words), expectIndex) {
+		t.Errorf("\n%v isn't equal to expected\n%v", idx.Words, expectIndex)
+	}
+}
+
+func TestIndexWatch(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt": "cup of tea",
+	})
+	defer os.RemoveAll(root)
+
+	idx := NewIndex(root)
+	if _, err := idx.Update(Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		idx.Watch(time.Millisecond, Options{}, stop)
+	}()
+
+	if err := ioutil.WriteFile(filepath.Join(root, "2.txt"), []byte("black tea"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		var err error
+		actual, err = idx.Searching("tea")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) == 2 {
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if len(actual) != 2 {
+		t.Errorf("created file isn't found by watched index, result %v", actual)
+	}
+}
+
+func TestIndexWatchDepth(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt":     "cup of tea",
+		"dir/2.txt": "green tea",
+	})
+	defer os.RemoveAll(root)
+
+	built := NewIndex(root)
+	if _, err := built.Update(Options{MaxDepth: 1}); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "index.json")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := built.WriteJSON(file); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	idx, err := ReadIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.MaxDepth != 1 {
+		t.Fatalf("%v isn't equal to expected %v", idx.MaxDepth, 1)
+	}
+	if segment := openSegment(t, built); segment.seg.maxDepth != 1 {
+		t.Fatalf("%v isn't equal to expected %v", segment.seg.maxDepth, 1)
+	}
+
+	stop := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		idx.Watch(time.Millisecond, Options{}, stop)
+	}()
+
+	if err := ioutil.WriteFile(filepath.Join(root, "dir", "4.txt"), []byte("black tea"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "3.txt"), []byte("black tea"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual []string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		actual, err = idx.Searching("tea")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(actual) > 1 {
+			break
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	sort.Strings(actual)
+	expect := []string{"1.txt", "3.txt"}
+	if !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+}
+
+// memoryIndex is watched index keeping state of files in memory, adding of files fails if fail is set
+type memoryIndex struct {
+	docs Manifest
+	fail bool
+}
+
+func (m *memoryIndex) manifest() (Manifest, error) {
+	manifest := make(Manifest, len(m.docs))
+	for name, doc := range m.docs {
+		manifest[name] = doc
+	}
+	return manifest, nil
+}
+
+func (m *memoryIndex) addFile(name string, doc Document, tokens []Token) error {
+	if m.fail {
+		return errors.New("Insert of positions is failed")
+	}
+	m.docs[name] = doc
+	return nil
+}
+
+func (m *memoryIndex) saveState(name string, doc Document) error {
+	m.docs[name] = doc
+	return nil
+}
+
+func (m *memoryIndex) deleteFile(name string) error {
+	delete(m.docs, name)
+	return nil
+}
+
+func (m *memoryIndex) renameFile(oldName, newName string, doc Document) error {
+	delete(m.docs, oldName)
+	m.docs[newName] = doc
+	return nil
+}
+
+func TestApplyChangesFailedInsert(t *testing.T) {
+	root := makeFolder(t, map[string]string{
+		"1.txt": "cup of tea",
+	})
+	defer os.RemoveAll(root)
+
+	index := &memoryIndex{docs: Manifest{}}
+	manifest, _ := index.manifest()
+	events, err := scanFolder(root, 0, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyChanges(index, root, manifest, events, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(root, "1.txt")
+	if err := ioutil.WriteFile(path, []byte("black tea"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	index.fail = true
+	events, err = scanFolder(root, 0, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyChanges(index, root, manifest, events, Options{}); err == nil {
+		t.Fatal("failed insert isn't returned")
+	}
+
+	index.fail = false
+	restarted, _ := index.manifest()
+	for name, manifest := range map[string]Manifest{"watching": manifest, "restarted": restarted} {
+		events, err := scanFolder(root, 0, manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].Op != Modify || events[0].Name != "1.txt" {
+			t.Fatalf("%v: failed file isn't found by the next scan, events %v", name, events)
+		}
+		if err := applyChanges(index, root, manifest, events, Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hash, err := hashFile(root, "1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.docs["1.txt"].Hash != hash {
+		t.Errorf("%v isn't equal to expected %v", index.docs["1.txt"].Hash, hash)
+	}
+}
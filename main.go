@@ -1,10 +1,12 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime"
 	"time"
 
 	"github.com/go-pg/pg/v9"
@@ -48,6 +50,22 @@ func main() {
 					Required: true,
 					Usage:    "path to directory",
 				},
+				&cli.IntFlag{
+					Name:    "depth",
+					Aliases: []string{"d"},
+					Value:   0,
+					Usage:   "max depth of indexed subdirectories, 0 is unlimited",
+				},
+				&cli.IntFlag{
+					Name:    "workers",
+					Aliases: []string{"w"},
+					Value:   runtime.NumCPU(),
+					Usage:   "count of workers reading and tokenizing files",
+				},
+				&cli.BoolFlag{
+					Name:  "rebuild",
+					Usage: "index all files again instead of updating changed files",
+				},
 			},
 			Subcommands: []*cli.Command{
 				{
@@ -55,6 +73,11 @@ func main() {
 					Usage:  "save index to json",
 					Action: indexJSON,
 				},
+				{
+					Name:   "bin",
+					Usage:  "save index to compact binary file",
+					Action: indexBinary,
+				},
 				{
 					Name:   "db",
 					Usage:  "save index to PostgeSQL darabase",
@@ -69,14 +92,27 @@ func main() {
 			Subcommands: []*cli.Command{
 				{
 					Name:   "json",
-					Usage:  "load index from json",
+					Usage:  "load index from json or binary file",
 					Action: searchJSON,
 					Flags: []cli.Flag{
 						&cli.StringFlag{
 							Name:     "index",
 							Aliases:  []string{"i"},
 							Required: true,
-							Usage:    "path to reverse index",
+							Usage:    "path to reverse index, json or binary",
+						},
+						&cli.BoolFlag{
+							Name:  "mmap",
+							Usage: "map binary index in memory instead of loading it",
+						},
+						&cli.BoolFlag{
+							Name:  "watch",
+							Usage: "apply changes of files in indexed directory while server is running",
+						},
+						&cli.DurationFlag{
+							Name:  "interval",
+							Value: 2 * time.Second,
+							Usage: "interval of checking indexed directory for changes",
 						},
 					},
 				},
@@ -84,6 +120,22 @@ func main() {
 					Name:   "db",
 					Usage:  "load index from PostgeSQL darabase",
 					Action: searchDB,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "path",
+							Aliases: []string{"p"},
+							Usage:   "path to indexed directory, it's required for watching",
+						},
+						&cli.BoolFlag{
+							Name:  "watch",
+							Usage: "apply changes of files in indexed directory while server is running",
+						},
+						&cli.DurationFlag{
+							Name:  "interval",
+							Value: 2 * time.Second,
+							Usage: "interval of checking indexed directory for changes",
+						},
+					},
 				},
 			},
 		},
@@ -97,34 +149,153 @@ func main() {
 	}
 }
 
-func indexJSON(c *cli.Context) error {
-	path := c.String("path")
+func indexOptions(c *cli.Context) index.Options {
+	return index.Options{
+		MaxDepth: c.Int("depth"),
+		Workers:  c.Int("workers"),
+		Analyzer: analyzer(),
+	}
+}
 
-	if len(path) == 0 {
+// analyzer returns analyzer set in config
+func analyzer() index.Analyzer {
+	analyzer, err := index.AnalyzerByName(cfg.Analyzer)
+	if err != nil {
 		log.Fatal().
-			Err(errors.New("Path to folder not found")).
+			Err(err).
 			Msg("")
 	}
+	return analyzer
+}
 
-	index, err := index.IndexingFolder(path)
-	if err != nil {
+// rankers returns rankers with parameters from config, they are used instead of registered rankers
+// with the same names
+func rankers() map[string]index.Ranker {
+	bm25 := index.BM25{
+		K1: cfg.BM25K1,
+		B:  cfg.BM25B,
+	}
+	return map[string]index.Ranker{
+		bm25.Name(): bm25,
+	}
+}
+
+// searchOptions returns ranker, limit of wildcard expansions and distance of automatic fuzzy search
+// set in config
+func searchOptions() index.SearchOptions {
+	ranker, ok := rankers()[cfg.Ranker]
+	if !ok {
+		var err error
+		if ranker, err = index.RankerByName(cfg.Ranker); err != nil {
+			log.Fatal().
+				Err(err).
+				Msg("")
+		}
+	}
+	return index.SearchOptions{
+		Ranker:        ranker,
+		MaxExpansions: cfg.MaxExpansions,
+		AutoFuzzy:     cfg.AutoFuzzy,
+	}
+}
+
+// watchOptions returns options for watching, subdirectories are watched to the depth saved in index
+func watchOptions() index.Options {
+	return index.Options{
+		Workers:  1,
+		Analyzer: analyzer(),
+	}
+}
+
+func indexJSON(c *cli.Context) error {
+	Index := updateIndex(c, "index.json")
+
+	if err := saveIndex("index.json", Index.WriteJSON); err != nil {
 		log.Fatal().
 			Err(err).
 			Msg("")
 	}
+	return nil
+}
 
-	output, err := json.Marshal(index)
-	if err != nil {
+func indexBinary(c *cli.Context) error {
+	Index := updateIndex(c, "index.bin")
+
+	if err := saveIndex("index.bin", Index.WriteBinary); err != nil {
 		log.Fatal().
 			Err(err).
 			Msg("")
 	}
-	if err := ioutil.WriteFile("index.json", output, 0666); err != nil {
+	return nil
+}
+
+// updateIndex loads previous index of folder from output file and updates it,
+// new index is built if output file doesn't exist or --rebuild flag is set
+func updateIndex(c *cli.Context, output string) *index.Index {
+	path := c.String("path")
+
+	if len(path) == 0 {
+		log.Fatal().
+			Err(errors.New("Path to folder not found")).
+			Msg("")
+	}
+
+	Index := index.NewIndex(path)
+	if !c.Bool("rebuild") {
+		prev, err := index.ReadIndex(output)
+		switch {
+		case err == nil && prev.Root == Index.Root && index.CheckAnalyzer(prev.Analyzer, cfg.Analyzer) == nil:
+			Index = prev
+		case err == nil && prev.Root == Index.Root:
+			log.Info().
+				Str("analyzer", prev.Analyzer).
+				Msg("Index built with other analyzer is rebuilt")
+		case err == nil:
+			log.Info().
+				Str("folder", prev.Root).
+				Msg("Index of other folder is rebuilt")
+		case !os.IsNotExist(err):
+			log.Fatal().
+				Err(err).
+				Msg("")
+		}
+	}
+
+	changes, err := Index.Update(indexOptions(c))
+	if err != nil {
 		log.Fatal().
 			Err(err).
 			Msg("")
 	}
-	return nil
+	log.Info().
+		Int("added", changes.Added).
+		Int("updated", changes.Updated).
+		Int("removed", changes.Removed).
+		Int("unchanged", changes.Unchanged).
+		Msg("Index is updated")
+	return Index
+}
+
+// saveIndex writes index to temporary file and replaces output file with it
+func saveIndex(output string, write func(w io.Writer) error) error {
+	file, err := ioutil.TempFile(filepath.Dir(output), filepath.Base(output)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), output)
 }
 
 func indexDB(c *cli.Context) error {
@@ -138,8 +309,9 @@ func indexDB(c *cli.Context) error {
 	}
 	db := pg.Connect(pgOpt)
 	defer db.Close()
+	checkSchema(db)
 
-	if err = index.IndexingFolderDB(db, folder); err != nil {
+	if err = index.IndexingFolderDBWith(db, folder, indexOptions(c)); err != nil {
 		log.Fatal().
 			Err(err).
 			Msg("")
@@ -147,22 +319,65 @@ func indexDB(c *cli.Context) error {
 	return nil
 }
 
+// checkSchema stops the program if tables of db are created by older version
+func checkSchema(db *pg.DB) {
+	if err := index.CheckSchemaDB(db); err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("")
+	}
+}
+
 func searchJSON(c *cli.Context) error {
 
 	indexName := c.String("index")
 
-	Index, err := index.ReadIndexJSON(indexName)
-	if err != nil {
+	if c.Bool("mmap") && c.Bool("watch") {
 		log.Fatal().
-			Err(err).
+			Err(errors.New("Mapped index can't be watched")).
 			Msg("")
 	}
 
 	handle := web.HandleObject{
-		Index: Index,
+		Search:  searchOptions(),
+		Rankers: rankers(),
 	}
+	if c.Bool("mmap") {
+		segment, err := index.OpenSegment(indexName)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Msg("")
+		}
+		defer segment.Close()
+		if err := index.CheckAnalyzer(segment.Analyzer(), cfg.Analyzer); err != nil {
+			log.Fatal().
+				Err(err).
+				Msg("")
+		}
+		handle.Store = segment
+	} else {
+		Index, err := index.ReadIndex(indexName)
+		if err != nil {
+			log.Fatal().
+				Err(err).
+				Msg("")
+		}
+		if err := index.CheckAnalyzer(Index.Analyzer, cfg.Analyzer); err != nil {
+			log.Fatal().
+				Err(err).
+				Msg("")
+		}
+		handle.Store = Index
 
-	if err = web.ServerStart(cfg.Listen, 10*time.Second, handle); err != nil {
+		if c.Bool("watch") {
+			stop := make(chan struct{})
+			defer close(stop)
+			go Index.Watch(c.Duration("interval"), watchOptions(), stop)
+		}
+	}
+
+	if err := web.ServerStart(cfg.Listen, 10*time.Second, handle); err != nil {
 		log.Fatal().
 			Err(err).
 			Msg("")
@@ -180,9 +395,49 @@ func searchDB(c *cli.Context) error {
 	}
 	db := pg.Connect(pgOpt)
 	defer db.Close()
+	checkSchema(db)
+
+	dbAnalyzer, err := index.AnalyzerDB(db)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("")
+	}
+	if err := index.CheckAnalyzer(dbAnalyzer, cfg.Analyzer); err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("")
+	}
+
+	if c.Bool("watch") {
+		if len(c.String("path")) == 0 {
+			log.Fatal().
+				Err(errors.New("Path to folder not found")).
+				Msg("")
+		}
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			if err := index.WatchDB(db, c.String("path"), c.Duration("interval"), watchOptions(), stop); err != nil {
+				log.Error().Err(err).Msg("Watching err")
+			}
+		}()
+	}
+
+	root, err := index.RootDB(db)
+	if err != nil {
+		log.Fatal().
+			Err(err).
+			Msg("")
+	}
+	if len(c.String("path")) != 0 {
+		root = c.String("path")
+	}
 
 	handle := web.HandleObject{
-		DB: db,
+		Store:   index.NewDB(db, analyzer(), root),
+		Search:  searchOptions(),
+		Rankers: rankers(),
 	}
 
 	if err = web.ServerStart(cfg.Listen, 10*time.Second, handle); err != nil {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/go-pg/pg/v9"
+	"github.com/go-pg/pg/v9/orm"
 	_ "github.com/lib/pq"
 )
 
@@ -13,18 +14,34 @@ type Word struct {
 }
 
 type File struct {
-	Id   int    `pg:"f_id,pk"`
-	File string `pg:"name_file"`
+	Id      int    `pg:"f_id,pk"`
+	File    string `pg:"name_file"`
+	Length  int    `pg:"length,use_zero"`
+	Size    int64  `pg:"size,use_zero"`
+	ModTime int64  `pg:"mod_time,use_zero"`
+	Hash    string `pg:"hash"`
 }
 
 type Position struct {
 	Wid      int    `pg:"w_id,pk"`
 	Fid      int    `pg:"f_id,pk"`
-	Position int `pg:"position"`
+	Position int    `pg:"position"`
+	Offset   int    `pg:"byte_offset,use_zero"`
+	Length   int    `pg:"length,use_zero"`
+	Line     int    `pg:"line,use_zero"`
+	Form     string `pg:"form"`
+}
+
+// Meta is settings of index saved in db
+type Meta struct {
+	tableName struct{} `pg:"meta"`
+
+	Key   string `pg:"key,pk"`
+	Value string `pg:"value"`
 }
 
 // Delete - delete from table where value column = val
-func Delete(db *pg.DB, table, column, val string) error {
+func Delete(db orm.DB, table, column, val string) error {
 	query := fmt.Sprintf(`DELETE FROM %s WHERE %s = ?`, table, column)
 	_, err := db.Exec(query, val)
 	if err != nil {
@@ -33,7 +50,7 @@ func Delete(db *pg.DB, table, column, val string) error {
 	return nil
 }
 
-func (w *Word) CheckAndInsert(db *pg.DB) (bool, error) {
+func (w *Word) CheckAndInsert(db orm.DB) (bool, error) {
 	ok, err := db.Model(w).
 		Where("word = ?", w.Word).
 		SelectOrInsert()
@@ -43,7 +60,7 @@ func (w *Word) CheckAndInsert(db *pg.DB) (bool, error) {
 	return ok, nil
 }
 
-func (f *File) CheckAndInsert(db *pg.DB) (bool, error) {
+func (f *File) CheckAndInsert(db orm.DB) (bool, error) {
 	ok, err := db.Model(f).
 		Where("name_file = ?", f.File).
 		SelectOrInsert()
@@ -53,8 +70,29 @@ func (f *File) CheckAndInsert(db *pg.DB) (bool, error) {
 	return ok, nil
 }
 
+// CheckAndInsert - insert setting if it isn't saved, saved value is selected otherwise
+func (m *Meta) CheckAndInsert(db *pg.DB) (bool, error) {
+	return db.Model(m).
+		Where("key = ?", m.Key).
+		SelectOrInsert()
+}
+
+// Save - insert setting or replace its saved value
+func (m *Meta) Save(db *pg.DB) error {
+	_, err := db.Model(m).
+		OnConflict("(key) DO UPDATE").
+		Set("value = EXCLUDED.value").
+		Insert()
+	return err
+}
+
+// SelectRow - select value of setting
+func (m *Meta) SelectRow(db *pg.DB) error {
+	return db.Model(m).Where("key = ?", m.Key).Select()
+}
+
 // Insert - insert in table valsSlice values to columns
-func Insert(db *pg.DB, buffer []Position) error {
+func Insert(db orm.DB, buffer []Position) error {
 	err := db.Insert(&buffer)
 	if err != nil {
 		return err
@@ -62,7 +100,7 @@ func Insert(db *pg.DB, buffer []Position) error {
 	return nil
 }
 
-func SelectWords(db *pg.DB) (map[string]int, error) {
+func SelectWords(db orm.DB) (map[string]int, error) {
 	result := make(map[string]int)
 	var words []Word
 	err := db.Model(&words).Select()
@@ -88,10 +126,73 @@ func SelectFiles(db *pg.DB) (map[int]string, error) {
 	return result, nil
 }
 
+// SelectFileLengths - select count of tokens of every file by its id
+func SelectFileLengths(db *pg.DB) (map[int]int, error) {
+	result := make(map[int]int)
+	var files []File
+	err := db.Model(&files).Column("f_id", "length").Select()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		result[file.Id] = file.Length
+	}
+	return result, nil
+}
+
+// DeleteFile - delete file and positions of its words
+func DeleteFile(db *pg.DB, name string) error {
+	return db.RunInTransaction(func(tx *pg.Tx) error {
+		file := File{}
+		if err := tx.Model(&file).Where("name_file = ?", name).Select(); err != nil {
+			if err == pg.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+		if _, err := tx.Exec(`DELETE FROM positions WHERE f_id = ?`, file.Id); err != nil {
+			return err
+		}
+		_, err := tx.Model(&file).WherePK().Delete()
+		return err
+	})
+}
+
+// RenameFile - change name of file keeping positions of its words
+func RenameFile(db orm.DB, oldName, newName string) error {
+	_, err := db.Model(&File{}).
+		Set("name_file = ?", newName).
+		Where("name_file = ?", oldName).
+		Update()
+	return err
+}
+
 func (w *Word) SelectRow(db *pg.DB) error {
 	return db.Model(w).Where("word = ?", w.Word).Select()
 }
 
+// UpdateState - save count of tokens, size, modification time and hash of content of file by its name
+func (f *File) UpdateState(db orm.DB) error {
+	_, err := db.Model(f).
+		Set("length = ?length, size = ?size, mod_time = ?mod_time, hash = ?hash").
+		Where("name_file = ?name_file").
+		Update()
+	return err
+}
+
+// SelectFileStates - select all files with count of tokens, size, modification time and hash of content
+func SelectFileStates(db *pg.DB) ([]File, error) {
+	var files []File
+	if err := db.Model(&files).Select(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (f *File) SelectRow(db *pg.DB) error {
+	return db.Model(f).Where("name_file = ?", f.File).Select()
+}
+
 func SelectPositions(db *pg.DB, w_id int) ([]Position, error) {
 	var positions []Position
 	if err := db.Model(&positions).Where("w_id = ?", w_id).Select(); err != nil {
@@ -99,3 +200,133 @@ func SelectPositions(db *pg.DB, w_id int) ([]Position, error) {
 	}
 	return positions, nil
 }
+
+// SelectWordsLike - select up to limit words matching pattern of LIKE in sorted order, limit 0 means no limit
+func SelectWordsLike(db *pg.DB, pattern string, limit int) ([]string, error) {
+	var words []string
+	query := db.Model((*Word)(nil)).
+		Column("word").
+		Where("word LIKE ?", pattern).
+		Order("word")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Select(&words); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// SelectWordsFuzzy - select up to limit the closest words within levenshtein distance from word,
+// limit 0 means no limit. It needs fuzzystrmatch extension
+func SelectWordsFuzzy(db *pg.DB, word string, distance, limit int) ([]string, error) {
+	var words []string
+	query := db.Model((*Word)(nil)).
+		Column("word").
+		Where("length(word) BETWEEN ? AND ?", len([]rune(word))-distance, len([]rune(word))+distance).
+		Where("left(word, 1) = left(?, 1)", word).
+		Where("levenshtein(word, ?) <= ?", word, distance).
+		OrderExpr("levenshtein(word, ?), word", word)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Select(&words); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// WordFreq is word with count of files containing it
+type WordFreq struct {
+	Word string
+	Freq int
+}
+
+// SelectWordFreqs - select up to limit words matching pattern of LIKE with count of files containing them,
+// the most frequent words are the first
+func SelectWordFreqs(db *pg.DB, pattern string, limit int) ([]WordFreq, error) {
+	var words []WordFreq
+	_, err := db.Query(&words, `
+		SELECT w.word, count(DISTINCT p.f_id) AS freq
+		FROM words w JOIN positions p ON p.w_id = w.w_id
+		WHERE w.word LIKE ?
+		GROUP BY w.word
+		ORDER BY freq DESC, w.word
+		LIMIT ?`, pattern, limit)
+	if err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+// CountWords - select count of indexed words
+func CountWords(db *pg.DB) (int, error) {
+	return db.Model((*Word)(nil)).Count()
+}
+
+// WordForm is surface form of word with count of files containing the form
+type WordForm struct {
+	Form string
+	Word string
+	Freq int
+}
+
+// SelectFormsLike - select up to limit surface forms matching pattern of LIKE with their words
+// and count of files, sorted by form. Limit 0 means no limit
+func SelectFormsLike(db *pg.DB, pattern string, limit int) ([]WordForm, error) {
+	return selectForms(db, `WHERE p.form LIKE ?0`, `p.form, w.word`, limit, pattern)
+}
+
+// SelectFormsFuzzy - select up to limit the closest surface forms within levenshtein distance from word
+// with their words and count of files, limit 0 means no limit. It needs fuzzystrmatch extension
+func SelectFormsFuzzy(db *pg.DB, word string, distance, limit int) ([]WordForm, error) {
+	return selectForms(db,
+		`WHERE length(p.form) BETWEEN ?1 AND ?2 AND left(p.form, 1) = left(?0, 1) AND levenshtein(p.form, ?0) <= ?3`,
+		`levenshtein(p.form, ?0), p.form, w.word`,
+		limit, word, len([]rune(word))-distance, len([]rune(word))+distance, distance)
+}
+
+// SelectFormFreqs - select up to limit surface forms matching pattern of LIKE with their words
+// and count of files, the most frequent forms are the first
+func SelectFormFreqs(db *pg.DB, pattern string, limit int) ([]WordForm, error) {
+	return selectForms(db, `WHERE p.form LIKE ?0`, `freq DESC, p.form, w.word`, limit, pattern)
+}
+
+func selectForms(db *pg.DB, where, order string, limit int, params ...interface{}) ([]WordForm, error) {
+	query := `
+		SELECT p.form, w.word, count(DISTINCT p.f_id) AS freq
+		FROM positions p JOIN words w ON w.w_id = p.w_id
+		` + where + `
+		GROUP BY p.form, w.word
+		ORDER BY ` + order
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	var forms []WordForm
+	if _, err := db.Query(&forms, query, params...); err != nil {
+		return nil, err
+	}
+	return forms, nil
+}
+
+// HasForms - check if surface forms of words are saved, db indexed by older versions has no forms
+func HasForms(db *pg.DB) (bool, error) {
+	return db.Model((*Position)(nil)).Where("form IS NOT NULL").Exists()
+}
+
+// SelectColumns - select names of columns of table
+func SelectColumns(db *pg.DB, table string) ([]string, error) {
+	var columns pg.Strings
+	_, err := db.Query(&columns, `SELECT column_name FROM information_schema.columns WHERE table_name = ?`, table)
+	if err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// HasExtension - check if extension is installed
+func HasExtension(db *pg.DB, name string) (bool, error) {
+	var ok bool
+	_, err := db.QueryOne(pg.Scan(&ok), `SELECT EXISTS(SELECT 1 FROM pg_extension WHERE extname = ?)`, name)
+	return ok, err
+}
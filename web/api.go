@@ -0,0 +1,198 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/polisgo2020/search-tarival/index"
+)
+
+const (
+	// defaultPageSize is count of results on page if size parameter isn't set
+	defaultPageSize = 10
+	// maxPageSize is max count of results on page
+	maxPageSize = 100
+)
+
+// apiResponse is result of /api/v1/search. Terms are analyzed words of query,
+// Total is count of all found files and Results are found files of the page
+type apiResponse struct {
+	Query      string      `json:"query"`
+	Terms      []string    `json:"terms"`
+	Total      int         `json:"total"`
+	Page       int         `json:"page"`
+	Size       int         `json:"size"`
+	Suggestion string      `json:"suggestion,omitempty"`
+	Results    []apiResult `json:"results"`
+}
+
+// apiResult is found file, Terms are matched terms and Positions are places of them in file
+type apiResult struct {
+	Path      string        `json:"path"`
+	Score     float64       `json:"score"`
+	Terms     []string      `json:"terms"`
+	Positions []apiPosition `json:"positions"`
+	Snippets  []apiSnippet  `json:"snippets"`
+}
+
+type apiPosition struct {
+	Term     string `json:"term"`
+	Position int    `json:"position"`
+}
+
+type apiSnippet struct {
+	Line       int       `json:"line"`
+	Text       string    `json:"text"`
+	Highlights []apiSpan `json:"highlights"`
+}
+
+// apiSpan is place of matched term in text of snippet
+type apiSpan struct {
+	Offset int `json:"offset"`
+	Length int `json:"length"`
+}
+
+// apiStats is result of /api/v1/stats
+type apiStats struct {
+	Files     int     `json:"files"`
+	Words     int     `json:"words"`
+	AvgLength float64 `json:"avgLength"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// handleSearchAPI writes json results of query parameter. Page starts from 1, size is count of results
+// on page, rank sets ranking of results. Errors are written as json with error message
+func (handle handler) handleSearchAPI(w http.ResponseWriter, r *http.Request) {
+	query := r.FormValue("query")
+	rank := r.FormValue("rank")
+	if query == "" {
+		writeAPIError(w, http.StatusBadRequest, "query parameter is required")
+		return
+	}
+	page, err := intParam(r, "page", 1)
+	if err != nil || page < 1 {
+		writeAPIError(w, http.StatusBadRequest, "page must be positive number")
+		return
+	}
+	size, err := intParam(r, "size", defaultPageSize)
+	if err != nil || size < 1 || size > maxPageSize {
+		writeAPIError(w, http.StatusBadRequest, "size must be number from 1 to "+strconv.Itoa(maxPageSize))
+		return
+	}
+
+	opts := handle.data.Search
+	if rank != "" {
+		if opts.Ranker, err = handle.data.ranker(rank); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	results, err := handle.data.Store.Search(query, opts)
+	if err != nil {
+		var queryErr *index.QueryError
+		if errors.As(err, &queryErr) || errors.Is(err, index.ErrOnlyExcluded) ||
+			errors.Is(err, index.ErrNoKeywords) {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Error().Err(err).Msg("Searching err")
+		writeAPIError(w, http.StatusInternalServerError, "Searching is failed")
+		return
+	}
+
+	response := apiResponse{
+		Query:   query,
+		Terms:   append([]string{}, results.Keywords...),
+		Total:   len(results.Matches),
+		Page:    page,
+		Size:    size,
+		Results: []apiResult{},
+	}
+	if suggestion, err := handle.data.Store.Suggest(query); err != nil {
+		log.Error().Err(err).Msg("Suggestion err")
+	} else {
+		response.Suggestion = suggestion
+	}
+
+	start, end := pageBounds(len(results.Matches), page, size)
+	for _, match := range results.Matches[start:end] {
+		result := apiResult{
+			Path:      match.File,
+			Score:     match.Score,
+			Terms:     []string{},
+			Positions: make([]apiPosition, len(match.Hits)),
+			Snippets:  []apiSnippet{},
+		}
+		for i, hit := range match.Hits {
+			result.Positions[i] = apiPosition{Term: hit.Keyword, Position: hit.Position}
+			if !contains(result.Terms, hit.Keyword) {
+				result.Terms = append(result.Terms, hit.Keyword)
+			}
+		}
+		snippets, err := handle.data.Store.Snippets(match, snippetsCount)
+		if err != nil {
+			log.Error().Err(err).Str("File", match.File).Msg("Snippets err")
+		}
+		for _, snippet := range snippets {
+			s := apiSnippet{Line: snippet.Line, Text: snippet.Text, Highlights: []apiSpan{}}
+			for _, span := range snippet.Highlights {
+				s.Highlights = append(s.Highlights, apiSpan{Offset: span.Offset, Length: span.Length})
+			}
+			result.Snippets = append(result.Snippets, s)
+		}
+		response.Results = append(response.Results, result)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleStatsAPI writes json statistics of index
+func (handle handler) handleStatsAPI(w http.ResponseWriter, r *http.Request) {
+	stats, err := handle.data.Store.Stats()
+	if err != nil {
+		log.Error().Err(err).Msg("Stats err")
+		writeAPIError(w, http.StatusInternalServerError, "Stats aren't available")
+		return
+	}
+	writeJSON(w, http.StatusOK, apiStats{Files: stats.Files, Words: stats.Words, AvgLength: stats.AvgLength})
+}
+
+// pageBounds returns bounds of page of total results, they are equal to total after the last page
+func pageBounds(total, page, size int) (int, int) {
+	start := (page - 1) * size
+	if start > total {
+		start = total
+	}
+	end := start + size
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+// intParam returns number in parameter of request or def if parameter isn't set
+func intParam(r *http.Request, name string, def int) (int, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("Write json err")
+	}
+}
@@ -0,0 +1,145 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/polisgo2020/search-tarival/index"
+)
+
+// failingStore is store which searching always fails
+type failingStore struct {
+	index.Store
+}
+
+func (failingStore) Search(searchPhrase string, opts index.SearchOptions) (index.Results, error) {
+	return index.Results{}, errors.New("connection refused")
+}
+
+// keywordlessStore is store which finds file without keywords and hits
+type keywordlessStore struct {
+	index.Store
+}
+
+func (keywordlessStore) Search(searchPhrase string, opts index.SearchOptions) (index.Results, error) {
+	return index.Results{Matches: []index.SearchResult{{File: "1.txt"}}}, nil
+}
+
+func (keywordlessStore) Suggest(searchPhrase string) (string, error) {
+	return "", nil
+}
+
+func (keywordlessStore) Snippets(result index.SearchResult, count int) ([]index.Snippet, error) {
+	return nil, nil
+}
+
+// backward is ranker which sorts matches by file name in reverse order
+type backward struct{}
+
+func (backward) Name() string {
+	return "backward"
+}
+
+func (backward) Rank(matches []index.Match, stats index.Stats) {
+	sort.Slice(matches, func(i, j int) bool { return matches[i].File > matches[j].File })
+}
+
+func TestHandleSearchAPI(t *testing.T) {
+	h := newTestHandler(t, map[string]string{
+		"1.txt": "black tea",
+		"2.txt": "tea cup",
+		"3.txt": "cup of tea with milk",
+		"4.txt": "coffee",
+	})
+	h.data.Rankers = map[string]index.Ranker{"backward": backward{}}
+
+	cases := []struct {
+		params url.Values
+		status int
+		total  int
+		paths  []string
+	}{
+		{url.Values{"query": {"tea"}}, http.StatusOK, 3, []string{"1.txt", "2.txt", "3.txt"}},
+		{url.Values{"query": {"tea"}, "size": {"2"}}, http.StatusOK, 3, []string{"1.txt", "2.txt"}},
+		{url.Values{"query": {"tea"}, "size": {"2"}, "page": {"2"}}, http.StatusOK, 3, []string{"3.txt"}},
+		{url.Values{"query": {"tea"}, "page": {"5"}}, http.StatusOK, 3, []string{}},
+		{url.Values{"query": {"tea cup"}, "rank": {"bm25"}, "size": {"1"}}, http.StatusOK, 3, []string{"2.txt"}},
+		{url.Values{"query": {"tea"}, "rank": {"backward"}}, http.StatusOK, 3, []string{"3.txt", "2.txt", "1.txt"}},
+		{url.Values{"query": {"milk*"}}, http.StatusOK, 1, []string{"3.txt"}},
+		{url.Values{"query": {"juice"}}, http.StatusOK, 0, []string{}},
+		{url.Values{}, http.StatusBadRequest, 0, nil},
+		{url.Values{"query": {"tea"}, "page": {"0"}}, http.StatusBadRequest, 0, nil},
+		{url.Values{"query": {"tea"}, "page": {"one"}}, http.StatusBadRequest, 0, nil},
+		{url.Values{"query": {"tea"}, "size": {"0"}}, http.StatusBadRequest, 0, nil},
+		{url.Values{"query": {"tea"}, "size": {"101"}}, http.StatusBadRequest, 0, nil},
+		{url.Values{"query": {"tea"}, "rank": {"random"}}, http.StatusBadRequest, 0, nil},
+		{url.Values{"query": {`"black tea`}}, http.StatusBadRequest, 0, nil},
+		{url.Values{"query": {"-tea"}}, http.StatusBadRequest, 0, nil},
+		{url.Values{"query": {"the"}}, http.StatusBadRequest, 0, nil},
+	}
+	for _, c := range cases {
+		status, body := serve(h.handleSearchAPI, c.params)
+		if status != c.status {
+			t.Errorf("%v: status %v isn't equal to expected %v: %s", c.params, status, c.status, body)
+			continue
+		}
+		if status != http.StatusOK {
+			var apiErr apiError
+			if err := json.Unmarshal(body, &apiErr); err != nil || apiErr.Error == "" {
+				t.Errorf("%v: %s isn't error message", c.params, body)
+			}
+			continue
+		}
+		var response apiResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			t.Fatal(err)
+		}
+		paths := []string{}
+		for _, result := range response.Results {
+			paths = append(paths, result.Path)
+		}
+		if response.Total != c.total || !reflect.DeepEqual(paths, c.paths) {
+			t.Errorf("%v: %v %v isn't equal to expected %v %v", c.params, response.Total, paths, c.total, c.paths)
+		}
+	}
+
+	_, body := serve(h.handleSearchAPI, url.Values{"query": {"black"}})
+	var response apiResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatal(err)
+	}
+	expect := apiResult{
+		Path:      "1.txt",
+		Score:     1,
+		Terms:     []string{"black"},
+		Positions: []apiPosition{{Term: "black", Position: 0}},
+		Snippets: []apiSnippet{
+			{Line: 1, Text: "black tea", Highlights: []apiSpan{{Offset: 0, Length: 5}}},
+		},
+	}
+	if len(response.Results) != 1 || !reflect.DeepEqual(response.Results[0], expect) {
+		t.Errorf("%+v isn't equal to expected %+v", response.Results, expect)
+	}
+
+	h.data.Store = keywordlessStore{}
+	_, body = serve(h.handleSearchAPI, url.Values{"query": {"tea"}})
+	for _, empty := range []string{`"terms":[]`, `"positions":[]`, `"snippets":[]`} {
+		if !strings.Contains(string(body), empty) {
+			t.Errorf("%s doesn't contain %s", body, empty)
+		}
+	}
+	if strings.Contains(string(body), "null") {
+		t.Errorf("%s contains null", body)
+	}
+
+	h.data.Store = failingStore{}
+	if status, _ := serve(h.handleSearchAPI, url.Values{"query": {"tea"}}); status != http.StatusInternalServerError {
+		t.Errorf("status %v isn't equal to expected %v", status, http.StatusInternalServerError)
+	}
+}
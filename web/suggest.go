@@ -0,0 +1,144 @@
+package web
+
+import (
+	"container/list"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// suggestCount is max count of suggestions for typed prefix
+	suggestCount = 10
+	// maxLoggedQueries is max count of different queries kept for suggestions
+	maxLoggedQueries = 10000
+	// minSuggestedCount is min count of query before it's suggested
+	minSuggestedCount = 2
+)
+
+// queryLog counts queries of html search with found results, the most popular queries are suggested.
+// The least recently added query is forgotten if log is full, so new queries can gain counts
+type queryLog struct {
+	mu      sync.Mutex
+	recent  *list.List
+	queries map[string]*list.Element
+}
+
+// loggedQuery is element of queryLog.recent
+type loggedQuery struct {
+	text  string
+	count int
+}
+
+func newQueryLog() *queryLog {
+	return &queryLog{recent: list.New(), queries: make(map[string]*list.Element)}
+}
+
+// add counts query, the least recently added query is forgotten if log is full
+func (l *queryLog) add(query string) {
+	query = strings.Join(strings.Fields(query), " ")
+	if query == "" {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.queries[query]; ok {
+		e.Value.(*loggedQuery).count++
+		l.recent.MoveToFront(e)
+		return
+	}
+	if l.recent.Len() >= maxLoggedQueries {
+		oldest := l.recent.Back()
+		delete(l.queries, oldest.Value.(*loggedQuery).text)
+		l.recent.Remove(oldest)
+	}
+	l.queries[query] = l.recent.PushFront(&loggedQuery{text: query, count: 1})
+}
+
+// popular returns up to count the most popular queries starting with prefix, case is ignored.
+// Queries added less than minSuggestedCount times aren't returned
+func (l *queryLog) popular(prefix string, count int) []string {
+	prefix = strings.ToLower(strings.Join(strings.Fields(prefix), " "))
+	if prefix == "" {
+		return nil
+	}
+	l.mu.Lock()
+	var found []loggedQuery
+	for _, e := range l.queries {
+		query := *e.Value.(*loggedQuery)
+		if query.count >= minSuggestedCount && strings.HasPrefix(strings.ToLower(query.text), prefix) {
+			found = append(found, query)
+		}
+	}
+	l.mu.Unlock()
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].count != found[j].count {
+			return found[i].count > found[j].count
+		}
+		return found[i].text < found[j].text
+	})
+	var queries []string
+	for _, query := range found {
+		queries = append(queries, query.text)
+	}
+	if len(queries) > count {
+		queries = queries[:count]
+	}
+	return queries
+}
+
+// handleSuggest writes json array of suggestions for prefix parameter. Popular queries go first,
+// then the last word of prefix is completed by indexed words found in more files
+func (handle handler) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	prefix := r.FormValue("prefix")
+
+	suggestions := handle.queries.popular(prefix, suggestCount)
+	head, word := splitLastWord(prefix)
+	if word != "" && len(suggestions) < suggestCount {
+		completions, err := handle.data.Store.Complete(word, suggestCount)
+		if err != nil {
+			log.Error().Err(err).Msg("Completion err")
+			writeAPIError(w, http.StatusInternalServerError, "Suggestions aren't available")
+			return
+		}
+		for _, completion := range completions {
+			suggestion := head + completion.Word
+			if len(suggestions) < suggestCount && !contains(suggestions, suggestion) {
+				suggestions = append(suggestions, suggestion)
+			}
+		}
+	}
+	if suggestions == nil {
+		suggestions = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, suggestions)
+}
+
+// splitLastWord returns text before the last word and the last word, operators before the word
+// are kept in head. The word is empty if text ends with space
+func splitLastWord(text string) (string, string) {
+	i := 0
+	if space := strings.LastIndexFunc(text, unicode.IsSpace); space >= 0 {
+		_, size := utf8.DecodeRuneInString(text[space:])
+		i = space + size
+	}
+	for i < len(text) && strings.ContainsRune(`+-("`, rune(text[i])) {
+		i++
+	}
+	return text[:i], text[i:]
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/polisgo2020/search-tarival/index"
+)
+
+// newTestHandler returns handler searching in index of files, the folder is removed at the end of test
+func newTestHandler(t *testing.T, files map[string]string) handler {
+	root, err := ioutil.TempDir("", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(text), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx := index.NewIndex(root)
+	if _, err := idx.Update(index.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	return handler{
+		data:    HandleObject{Store: idx},
+		queries: newQueryLog(),
+	}
+}
+
+// serve calls handle with parameters and returns status and body of response
+func serve(handle http.HandlerFunc, params url.Values) (int, []byte) {
+	w := httptest.NewRecorder()
+	handle(w, httptest.NewRequest(http.MethodGet, "/?"+params.Encode(), nil))
+	return w.Code, w.Body.Bytes()
+}
+
+func TestHandleSuggest(t *testing.T) {
+	h := newTestHandler(t, map[string]string{
+		"1.txt": "black tea and teachers",
+		"2.txt": "Tea cup",
+		"3.txt": "green tea",
+	})
+	h.queries.add("tea cup")
+	h.queries.add("tea cup")
+	h.queries.add("tea cup")
+	h.queries.add("tea time")
+	h.queries.add("tea time")
+	h.queries.add("tea party")
+
+	cases := map[string][]string{
+		"te":         []string{"tea cup", "tea time", "tea", "teachers"},
+		"tea c":      []string{"tea cup"},
+		"green +tea": []string{"green +tea", "green +teachers"},
+		"milk":       []string{},
+		"":           []string{},
+	}
+	for prefix, expect := range cases {
+		status, body := serve(h.handleSuggest, url.Values{"prefix": {prefix}})
+		if status != http.StatusOK {
+			t.Errorf("%q: status %v isn't equal to expected %v", prefix, status, http.StatusOK)
+			continue
+		}
+		var actual []string
+		if err := json.Unmarshal(body, &actual); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, expect) {
+			t.Errorf("%q: %v isn't equal to expected %v", prefix, actual, expect)
+		}
+	}
+}
+
+func TestSplitLastWord(t *testing.T) {
+	cases := []struct {
+		text, head, word string
+	}{
+		{"", "", ""},
+		{"tea", "", "tea"},
+		{"black te", "black ", "te"},
+		{"black ", "black ", ""},
+		{"cup -te", "cup -", "te"},
+		{`("bla`, `("`, "bla"},
+		{"чёрный ча", "чёрный ", "ча"},
+	}
+	for _, c := range cases {
+		head, word := splitLastWord(c.text)
+		if head != c.head || word != c.word {
+			t.Errorf("%q: %q, %q isn't equal to expected %q, %q", c.text, head, word, c.head, c.word)
+		}
+	}
+}
+
+func TestQueryLog(t *testing.T) {
+	l := newQueryLog()
+	l.add("  tea   cup ")
+	l.add("tea cup")
+	l.add("tea cup")
+	l.add("Tea time")
+	l.add("Tea time")
+	l.add("tea party")
+	l.add("")
+	if actual, expect := l.popular("TEA", 10), []string{"tea cup", "Tea time"}; !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+	if actual, expect := l.popular("tea", 1), []string{"tea cup"}; !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+	if actual := l.popular(" ", 10); len(actual) != 0 {
+		t.Errorf("%v isn't empty", actual)
+	}
+
+	for i := len(l.queries); i < maxLoggedQueries; i++ {
+		l.add("query " + strconv.Itoa(i))
+	}
+	l.add("tea cup")
+	l.add("new query")
+	l.add("new query")
+	l.add("newer query")
+	l.add("newer query")
+	if len(l.queries) != maxLoggedQueries {
+		t.Errorf("count of queries %v isn't equal to expected %v", len(l.queries), maxLoggedQueries)
+	}
+	if actual, expect := l.popular("tea", 10), []string{"tea cup"}; !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+	if actual, expect := l.popular("new", 10), []string{"new query", "newer query"}; !reflect.DeepEqual(actual, expect) {
+		t.Errorf("%v isn't equal to expected %v", actual, expect)
+	}
+}
+
+func TestSearchAPIIsntLogged(t *testing.T) {
+	h := newTestHandler(t, map[string]string{"1.txt": "black tea"})
+	for i := 0; i < minSuggestedCount; i++ {
+		serve(h.handleSearchAPI, url.Values{"query": {"black tea"}})
+	}
+	if actual := h.queries.popular("black", 10); len(actual) != 0 {
+		t.Errorf("%v isn't empty", actual)
+	}
+}
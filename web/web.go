@@ -1,28 +1,46 @@
 package web
 
 import (
+	"errors"
 	"fmt"
 	"html"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
-	"github.com/go-pg/pg/v9"
 	"github.com/rs/zerolog/log"
 
 	"github.com/polisgo2020/search-tarival/index"
 )
 
-// HandleObject object for send index or db in ServerStart
+// HandleObject object for send storage of index in ServerStart.
+// Search sets ranking of results, it can be changed by rank parameter of request.
+// Rankers are chosen by rank parameter instead of registered rankers with the same names
 type HandleObject struct {
-	Index index.ReverseIndex
-	DB    *pg.DB
+	Store   index.Store
+	Search  index.SearchOptions
+	Rankers map[string]index.Ranker
 }
 
+// ranker returns ranker by name of rank parameter of request
+func (handle HandleObject) ranker(name string) (index.Ranker, error) {
+	if ranker, ok := handle.Rankers[name]; ok {
+		return ranker, nil
+	}
+	return index.RankerByName(name)
+}
+
+// snippetsCount is max count of snippets shown for every result
+const snippetsCount = 2
+
 type handler struct {
 	tmpIndex  *template.Template
 	tmpResult *template.Template
 	data      HandleObject
+	queries   *queryLog
 }
 
 // ServerStart is start the server at handle address, handle functions and index params
@@ -38,12 +56,12 @@ func ServerStart(listen string, timeout time.Duration, handle HandleObject) erro
 		WriteTimeout: timeout,
 	}
 
-	tmpIndex, err := template.ParseFiles("web/templates/index.html")
+	tmpIndex, err := template.ParseFiles("web/templates/index.html", "web/templates/suggest.html")
 	if err != nil {
 		return err
 	}
 
-	tmpResult, err := template.ParseFiles("web/templates/result.html")
+	tmpResult, err := template.ParseFiles("web/templates/result.html", "web/templates/suggest.html")
 	if err != nil {
 		return err
 	}
@@ -52,10 +70,14 @@ func ServerStart(listen string, timeout time.Duration, handle HandleObject) erro
 		tmpIndex:  tmpIndex,
 		tmpResult: tmpResult,
 		data:      handle,
+		queries:   newQueryLog(),
 	}
 
 	mux.HandleFunc("/", h.handleSearch)
 	mux.HandleFunc("/result", h.handleResult)
+	mux.HandleFunc("/suggest", h.handleSuggest)
+	mux.HandleFunc("/api/v1/search", h.handleSearchAPI)
+	mux.HandleFunc("/api/v1/stats", h.handleStatsAPI)
 
 	log.Info().
 		Str("Interface", listen).
@@ -64,31 +86,62 @@ func ServerStart(listen string, timeout time.Duration, handle HandleObject) erro
 	return server.ListenAndServe()
 }
 
+// resultLink returns escaped link to page of results of query, the first page has no page parameter
+func resultLink(query, rank string, page int) string {
+	link := "/result?query=" + url.QueryEscape(query)
+	if rank != "" {
+		link += "&rank=" + url.QueryEscape(rank)
+	}
+	if page > 1 {
+		link += "&page=" + strconv.Itoa(page)
+	}
+	return html.EscapeString(link)
+}
+
+// handleResult writes html page of results with the same page size as the api,
+// snippets are made only for results of the page
 func (handle handler) handleResult(w http.ResponseWriter, r *http.Request) {
-	query := html.EscapeString(r.FormValue("query"))
+	query := r.FormValue("query")
+	rank := r.FormValue("rank")
+	page, pageErr := intParam(r, "page", 1)
+	if pageErr != nil || page < 1 {
+		page = 1
+	}
 
-	log.Info().Str("Get search phrase", query).Msg("Get query")
+	log.Info().Str("Get search phrase", query).Str("rank", rank).Int("page", page).Msg("Get query")
 
 	var results string
 
 	tmpData := struct {
-		Results string
-		Query   string
+		Results        string
+		Query          string
+		Rank           string
+		Suggestion     string
+		SuggestionLink string
+		PrevLink       string
+		NextLink       string
 	}{
 		Results: "",
-		Query:   query,
+		Query:   html.EscapeString(query),
+		Rank:    html.EscapeString(rank),
 	}
 
 	var err error
-	var searchResult []string
-	if handle.data.Index != nil {
-		searchResult, err = handle.data.Index.Searching(query)
+	var searchResult index.Results
+	opts := handle.data.Search
+	if rank != "" {
+		opts.Ranker, err = handle.data.ranker(rank)
 	}
-	if handle.data.DB != nil {
-		searchResult, err = index.SearchingDB(handle.data.DB, query)
+	if err == nil {
+		searchResult, err = handle.data.Store.Search(query, opts)
 	}
 	if err != nil {
 		log.Error().Err(err).Msg("Searching err")
+		var queryErr *index.QueryError
+		if errors.As(err, &queryErr) || errors.Is(err, index.ErrOnlyExcluded) ||
+			errors.Is(err, index.ErrNoKeywords) {
+			tmpData.Results = html.EscapeString(err.Error())
+		}
 		err = handle.tmpResult.Execute(w, tmpData)
 		if err != nil {
 			log.Error().Err(err).Msg("Execute html template err")
@@ -96,11 +149,39 @@ func (handle handler) handleResult(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(searchResult) == 0 {
+	if suggestion, err := handle.data.Store.Suggest(query); err != nil {
+		log.Error().Err(err).Msg("Suggestion err")
+	} else if suggestion != "" {
+		tmpData.Suggestion = html.EscapeString(suggestion)
+		tmpData.SuggestionLink = resultLink(suggestion, rank, 1)
+	}
+
+	start, end := pageBounds(len(searchResult.Matches), page, defaultPageSize)
+	if page > 1 {
+		tmpData.PrevLink = resultLink(query, rank, page-1)
+	}
+	if end < len(searchResult.Matches) {
+		tmpData.NextLink = resultLink(query, rank, page+1)
+	}
+	switch {
+	case len(searchResult.Matches) == 0:
 		results = "Not found any result with your request"
-	} else {
-		for i, result := range searchResult {
-			results += fmt.Sprintf("<p>%v) %v</p>\n", i+1, result)
+	case start == end:
+		results = "Not found any result on this page"
+	default:
+		if page == 1 {
+			handle.queries.add(query)
+		}
+		for i, result := range searchResult.Matches[start:end] {
+			results += fmt.Sprintf("<p>%v) %v</p>\n", start+i+1, html.EscapeString(result.File))
+			snippets, err := handle.data.Store.Snippets(result, snippetsCount)
+			if err != nil {
+				log.Error().Err(err).Str("File", result.File).Msg("Snippets err")
+				continue
+			}
+			for _, snippet := range snippets {
+				results += fmt.Sprintf("<p class=\"snippet\">%v: %v</p>\n", snippet.Line, highlight(snippet))
+			}
 		}
 	}
 
@@ -112,8 +193,26 @@ func (handle handler) handleResult(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// highlight returns escaped text of snippet with keywords in <mark> tags
+func highlight(snippet index.Snippet) string {
+	var b strings.Builder
+	prev := 0
+	for _, span := range snippet.Highlights {
+		if span.Offset < prev || span.Offset+span.Length > len(snippet.Text) {
+			continue
+		}
+		b.WriteString(html.EscapeString(snippet.Text[prev:span.Offset]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(snippet.Text[span.Offset : span.Offset+span.Length]))
+		b.WriteString("</mark>")
+		prev = span.Offset + span.Length
+	}
+	b.WriteString(html.EscapeString(snippet.Text[prev:]))
+	return b.String()
+}
+
 func (handle handler) handleSearch(w http.ResponseWriter, r *http.Request) {
-	query := html.EscapeString(r.FormValue("query"))
+	query := r.FormValue("query")
 
 	if len(query) == 0 {
 		err := handle.tmpIndex.Execute(w, struct{}{})
@@ -122,7 +221,7 @@ func (handle handler) handleSearch(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	} else {
-		http.Redirect(w, r, "/result?query="+query, http.StatusFound)
+		http.Redirect(w, r, "/result?query="+url.QueryEscape(query), http.StatusFound)
 	}
 }
 
@@ -0,0 +1,71 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/polisgo2020/search-tarival/index"
+)
+
+// snippetsStore is store which counts files of made snippets
+type snippetsStore struct {
+	index.Store
+	files []string
+}
+
+func (s *snippetsStore) Snippets(result index.SearchResult, count int) ([]index.Snippet, error) {
+	s.files = append(s.files, result.File)
+	return s.Store.Snippets(result, count)
+}
+
+func TestHandleResultPages(t *testing.T) {
+	files := map[string]string{}
+	for i := 1; i <= defaultPageSize+2; i++ {
+		files[fmt.Sprintf("%02d.txt", i)] = "cup of tea"
+	}
+	h := newTestHandler(t, files)
+	tmpResult, err := template.ParseFiles("templates/result.html", "templates/suggest.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.tmpResult = tmpResult
+	store := &snippetsStore{Store: h.data.Store}
+	h.data.Store = store
+
+	cases := []struct {
+		page     string
+		snippets int
+		contains []string
+		excludes []string
+	}{
+		{"", defaultPageSize, []string{"1) ", "10) ", "page=2"}, []string{"11) ", "Previous"}},
+		{"2", 2, []string{"11) ", "12) ", "Previous"}, []string{"10) ", "Next"}},
+		{"3", 0, []string{"Not found any result on this page", "page=2"}, []string{"Next"}},
+		{"zero", defaultPageSize, []string{"1) "}, []string{"11) "}},
+	}
+	for _, c := range cases {
+		store.files = nil
+		status, body := serve(h.handleResult, url.Values{"query": {"tea"}, "page": {c.page}})
+		if status != http.StatusOK {
+			t.Errorf("%q: status %v isn't equal to expected %v", c.page, status, http.StatusOK)
+			continue
+		}
+		if len(store.files) != c.snippets {
+			t.Errorf("%q: count of snippets %v isn't equal to expected %v", c.page, len(store.files), c.snippets)
+		}
+		for _, s := range c.contains {
+			if !strings.Contains(string(body), s) {
+				t.Errorf("%q: %q isn't found in page", c.page, s)
+			}
+		}
+		for _, s := range c.excludes {
+			if strings.Contains(string(body), s) {
+				t.Errorf("%q: %q is found in page", c.page, s)
+			}
+		}
+	}
+}